@@ -0,0 +1,384 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	changeStatusNoChange = "no-change"
+	changeStatusFailed   = "failed"
+	changeStatusOpened   = "opened"
+	changeStatusMerged   = "merged"
+	changeStatusClosed   = "closed"
+)
+
+// batchChange 记录一次多仓库变更的状态，保存在 root/.doo/batch-changes/<name>.json 中，用于断点续做
+type batchChange struct {
+	Name        string                      `json:"name"`
+	Branch      string                      `json:"branch"`
+	Title       string                      `json:"title"`
+	Description string                      `json:"description"`
+	Repos       map[string]*batchChangeRepo `json:"repos"`
+	path        string
+}
+
+type batchChangeRepo struct {
+	Project   string    `json:"project"`
+	ProjectID int       `json:"project_id"`
+	Status    string    `json:"status"`
+	MRIID     int       `json:"mr_iid,omitempty"`
+	WebURL    string    `json:"web_url,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func loadBatchChange(ctx *cli.Context) (*batchChange, error) {
+	if ctx.NArg() == 0 {
+		return nil, fmt.Errorf("change set name required")
+	}
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return nil, err
+	}
+	name := ctx.Args().Get(0)
+	bc := &batchChange{
+		Name:  name,
+		Repos: make(map[string]*batchChangeRepo),
+		path:  filepath.Join(root, ".doo", "batch-changes", name+".json"),
+	}
+	content, err := os.ReadFile(bc.path)
+	if os.IsNotExist(err) {
+		return bc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, bc); err != nil {
+		return nil, fmt.Errorf("parse state file %s failed: %v", bc.path, err)
+	}
+	return bc, nil
+}
+
+func (bc *batchChange) save() error {
+	if err := os.MkdirAll(filepath.Dir(bc.path), 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(bc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bc.path, content, 0644)
+}
+
+func (bc *batchChange) print() {
+	var names []string
+	for name := range bc.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var counts = make(map[string]int)
+	fmt.Printf("*** %s: %s ***\n", bc.Name, bc.Title)
+	fmt.Printf("%-50s %-10s %s\n", "Project", "Status", "Merge Request")
+	for _, name := range names {
+		r := bc.Repos[name]
+		counts[r.Status]++
+		var detail = r.WebURL
+		if r.Error != "" {
+			detail = r.Error
+		}
+		fmt.Printf("%-50s %-10s %s\n", r.Project, r.Status, detail)
+	}
+	fmt.Println()
+	for _, status := range []string{changeStatusOpened, changeStatusMerged, changeStatusClosed, changeStatusNoChange, changeStatusFailed} {
+		fmt.Printf("%s: %v  ", status, counts[status])
+	}
+	fmt.Println()
+}
+
+// BatchChangeApply 在选中的本地克隆中创建分支、执行脚本或应用补丁、提交推送并创建合并请求，
+// 再次执行时会跳过已完成的项目，指定 --update 时重新应用到已打开合并请求的项目
+func BatchChangeApply(ctx *cli.Context) error {
+	bc, err := loadBatchChange(ctx)
+	if err != nil {
+		return err
+	}
+	var (
+		script = ctx.String("script")
+		patch  = ctx.String("patch")
+		update = ctx.Bool("update")
+	)
+	if (script == "") == (patch == "") {
+		return fmt.Errorf("one of --script and --patch is required")
+	}
+	if patch != "" {
+		if patch, err = filepath.Abs(patch); err != nil {
+			return err
+		}
+	}
+	if title := ctx.String("title"); title != "" {
+		bc.Title = title
+	}
+	if description := ctx.String("description"); description != "" {
+		bc.Description = description
+	}
+	if bc.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if bc.Branch == "" {
+		bc.Branch = ctx.String("branch")
+	}
+	if bc.Branch == "" {
+		bc.Branch = "doo/" + bc.Name
+	}
+
+	accessToken, err := utils.MustGetStringArg(ctx, "access_token", "DOO_GITLAB_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+	root, _ := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	repos, err := findLocalRepos(root, parseGroups(ctx), ctx.String("projects"))
+	if err != nil {
+		return err
+	}
+	if glob := ctx.String("if-exists"); glob != "" {
+		repos = filterReposByGlob(repos, glob)
+	}
+
+	var failed int
+	for _, repo := range repos {
+		state, ok := bc.Repos[repo.String()]
+		if !ok {
+			state = &batchChangeRepo{Project: repo.String()}
+			bc.Repos[repo.String()] = state
+		}
+		switch state.Status {
+		case changeStatusMerged, changeStatusClosed, changeStatusNoChange:
+			continue
+		case changeStatusOpened:
+			if !update {
+				continue
+			}
+		}
+
+		fmt.Printf("--- [INFO] Apply %s to %s\n", bc.Name, repo)
+		state.Error = ""
+		if err := applyBatchChange(bc, repo, state, script, patch, accessToken); err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] Apply %s to %s failed: %v\n", bc.Name, repo, err)
+			failed++
+			state.Status = changeStatusFailed
+			state.Error = err.Error()
+		}
+		state.UpdatedAt = time.Now()
+		if err := bc.save(); err != nil {
+			return err
+		}
+	}
+
+	bc.print()
+	if failed > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func applyBatchChange(bc *batchChange, repo *localRepo, state *batchChangeRepo, script, patch, accessToken string) error {
+	project, err := client.GetProject(repo.String())
+	if err != nil {
+		return err
+	}
+	state.ProjectID = project.ID
+
+	if out, err := runGit(repo.Dir, "status", "--porcelain"); err != nil {
+		return err
+	} else if out != "" {
+		return fmt.Errorf("working tree not clean")
+	}
+	current, err := runGit(repo.Dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	// 分离头指针时没有分支名，记录当前提交
+	if current == "HEAD" {
+		if current, err = runGit(repo.Dir, "rev-parse", "HEAD"); err != nil {
+			return err
+		}
+	}
+	// 开始前已确认工作区干净，结束时强制切回原分支，丢弃失败时留下的改动
+	defer func() {
+		_, _ = runGit(repo.Dir, "checkout", "-f", current)
+		_, _ = runGit(repo.Dir, "clean", "-fd")
+	}()
+
+	r, err := git.PlainOpen(repo.Dir)
+	if err != nil {
+		return err
+	}
+	err = r.Fetch(&git.FetchOptions{RemoteName: "origin", Auth: gitAuth(accessToken)})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	base := project.DefaultBranch
+	if _, err = runGit(repo.Dir, "checkout", "-B", bc.Branch, "origin/"+base); err != nil {
+		return err
+	}
+
+	if script != "" {
+		cmd := exec.Command("sh", "-c", script)
+		cmd.Dir = repo.Dir
+		cmd.Env = append(os.Environ(), "DOO_GROUP="+repo.Group, "DOO_PROJECT="+repo.Project)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("run script failed: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	} else if _, err = runGit(repo.Dir, "apply", patch); err != nil {
+		return err
+	}
+
+	if _, err = runGit(repo.Dir, "add", "-A"); err != nil {
+		return err
+	}
+	if out, err := runGit(repo.Dir, "status", "--porcelain"); err != nil {
+		return err
+	} else if out == "" {
+		// 没有改动时保留已打开的合并请求，避免 --update 重新执行后从报告中丢失
+		mr, err := client.GetOpenMergeRequest(project.ID, bc.Branch)
+		if err != nil {
+			return err
+		}
+		if mr == nil {
+			state.Status = changeStatusNoChange
+			return nil
+		}
+		state.Status = changeStatusOpened
+		state.MRIID = mr.IID
+		state.WebURL = mr.WebURL
+		return nil
+	}
+	var args = []string{"commit", "-m", bc.Title}
+	if bc.Description != "" {
+		args = append(args, "-m", bc.Description)
+	}
+	if _, err = runGit(repo.Dir, args...); err != nil {
+		return err
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", bc.Branch, bc.Branch))
+	err = r.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: []config.RefSpec{refSpec}, Auth: gitAuth(accessToken)})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	mr, err := client.GetOpenMergeRequest(project.ID, bc.Branch)
+	if err != nil {
+		return err
+	}
+	if mr == nil {
+		mr, err = client.CreateMergeRequest(project.ID, bc.Branch, base, bc.Title, bc.Description)
+	} else {
+		mr, err = client.UpdateMergeRequest(project.ID, mr.IID, bc.Title, bc.Description)
+	}
+	if err != nil {
+		return err
+	}
+	state.Status = changeStatusOpened
+	state.MRIID = mr.IID
+	state.WebURL = mr.WebURL
+	return nil
+}
+
+// BatchChangeStatus 从 gitlab 刷新合并请求状态并打印
+func BatchChangeStatus(ctx *cli.Context) error {
+	bc, err := loadBatchChange(ctx)
+	if err != nil {
+		return err
+	}
+	if len(bc.Repos) == 0 {
+		return fmt.Errorf("change set %s not found", bc.Name)
+	}
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+
+	for _, state := range bc.Repos {
+		if state.Status != changeStatusOpened {
+			continue
+		}
+		mr, err := client.GetMergeRequest(state.ProjectID, state.MRIID)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Get merge request of %s failed: %v\n", state.Project, err)
+			continue
+		}
+		if mr.State != state.Status {
+			state.Status = mr.State
+			state.UpdatedAt = time.Now()
+		}
+	}
+	if err = bc.save(); err != nil {
+		return err
+	}
+
+	bc.print()
+	return nil
+}
+
+// BatchChangeClose 关闭变更集中所有打开的合并请求，并删除远程分支
+func BatchChangeClose(ctx *cli.Context) error {
+	bc, err := loadBatchChange(ctx)
+	if err != nil {
+		return err
+	}
+	if len(bc.Repos) == 0 {
+		return fmt.Errorf("change set %s not found", bc.Name)
+	}
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+
+	for _, state := range bc.Repos {
+		if state.Status != changeStatusOpened {
+			continue
+		}
+		if _, err := client.CloseMergeRequest(state.ProjectID, state.MRIID); err != nil {
+			fmt.Printf("--- [ERROR] Close merge request of %s failed: %v\n", state.Project, err)
+			continue
+		}
+		if err := client.DeleteBranch(state.ProjectID, bc.Branch); err != nil {
+			fmt.Printf("--- [ERROR] Delete branch %s of %s failed: %v\n", bc.Branch, state.Project, err)
+		}
+		state.Status = changeStatusClosed
+		state.UpdatedAt = time.Now()
+	}
+	if err = bc.save(); err != nil {
+		return err
+	}
+
+	bc.print()
+	return nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
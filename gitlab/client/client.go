@@ -92,6 +92,12 @@ func GetGroupProjects(groupId int) ([]*gitlab.Project, error) {
 	return outs, nil
 }
 
+// GetGroup 通过分组ID或完整路径获取分组
+func GetGroup(gid interface{}) (*gitlab.Group, error) {
+	g, _, err := c.Groups.GetGroup(gid, &gitlab.GetGroupOptions{})
+	return g, err
+}
+
 func GetGroupByName(name string) (*gitlab.Group, error) {
 	var (
 		size = 100
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// GetProjectIssues 获取 since 之后有更新的所有议题，since 为 nil 时获取全部
+func GetProjectIssues(pid int, since *time.Time) ([]*gitlab.Issue, error) {
+	var (
+		outs []*gitlab.Issue
+		size = 100
+		page = 1
+	)
+	for {
+		is, _, err := c.Issues.ListProjectIssues(pid, &gitlab.ListProjectIssuesOptions{
+			ListOptions:  gitlab.ListOptions{PerPage: size, Page: page},
+			UpdatedAfter: since,
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, is...)
+		if len(is) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+// GetProjectMergeRequests 获取 since 之后有更新的所有合并请求，since 为 nil 时获取全部
+func GetProjectMergeRequests(pid int, since *time.Time) ([]*gitlab.MergeRequest, error) {
+	var (
+		outs []*gitlab.MergeRequest
+		size = 100
+		page = 1
+	)
+	for {
+		mrs, _, err := c.MergeRequests.ListProjectMergeRequests(pid, &gitlab.ListProjectMergeRequestsOptions{
+			ListOptions:  gitlab.ListOptions{PerPage: size, Page: page},
+			UpdatedAfter: since,
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, mrs...)
+		if len(mrs) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+func GetIssueNotes(pid, iid int) ([]*gitlab.Note, error) {
+	var (
+		outs []*gitlab.Note
+		size = 100
+		page = 1
+	)
+	for {
+		ns, _, err := c.Notes.ListIssueNotes(pid, iid, &gitlab.ListIssueNotesOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+			OrderBy:     pString("created_at"),
+			Sort:        pString("asc"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, ns...)
+		if len(ns) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+func GetMergeRequestNotes(pid, iid int) ([]*gitlab.Note, error) {
+	var (
+		outs []*gitlab.Note
+		size = 100
+		page = 1
+	)
+	for {
+		ns, _, err := c.Notes.ListMergeRequestNotes(pid, iid, &gitlab.ListMergeRequestNotesOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+			OrderBy:     pString("created_at"),
+			Sort:        pString("asc"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, ns...)
+		if len(ns) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+func GetProjectLabels(pid int) ([]*gitlab.Label, error) {
+	var (
+		outs []*gitlab.Label
+		size = 100
+		page = 1
+	)
+	for {
+		ls, _, err := c.Labels.ListLabels(pid, &gitlab.ListLabelsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, ls...)
+		if len(ls) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+func GetProjectMilestones(pid int) ([]*gitlab.Milestone, error) {
+	var (
+		outs []*gitlab.Milestone
+		size = 100
+		page = 1
+	)
+	for {
+		ms, _, err := c.Milestones.ListMilestones(pid, &gitlab.ListMilestonesOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, ms...)
+		if len(ms) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
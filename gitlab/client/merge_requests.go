@@ -0,0 +1,56 @@
+package client
+
+import (
+	"github.com/xanzy/go-gitlab"
+)
+
+func CreateMergeRequest(pid int, source, target, title, description string) (*gitlab.MergeRequest, error) {
+	mr, _, err := c.MergeRequests.CreateMergeRequest(pid, &gitlab.CreateMergeRequestOptions{
+		Title:              pString(title),
+		Description:        pString(description),
+		SourceBranch:       pString(source),
+		TargetBranch:       pString(target),
+		RemoveSourceBranch: gitlab.Bool(true),
+	})
+	return mr, err
+}
+
+// GetOpenMergeRequest 获取指定源分支上打开的合并请求，不存在时返回 nil
+func GetOpenMergeRequest(pid int, source string) (*gitlab.MergeRequest, error) {
+	mrs, _, err := c.MergeRequests.ListProjectMergeRequests(pid, &gitlab.ListProjectMergeRequestsOptions{
+		SourceBranch: pString(source),
+		State:        pString("opened"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+	return mrs[0], nil
+}
+
+func GetMergeRequest(pid, iid int) (*gitlab.MergeRequest, error) {
+	mr, _, err := c.MergeRequests.GetMergeRequest(pid, iid, nil)
+	return mr, err
+}
+
+func UpdateMergeRequest(pid, iid int, title, description string) (*gitlab.MergeRequest, error) {
+	mr, _, err := c.MergeRequests.UpdateMergeRequest(pid, iid, &gitlab.UpdateMergeRequestOptions{
+		Title:       pString(title),
+		Description: pString(description),
+	})
+	return mr, err
+}
+
+func CloseMergeRequest(pid, iid int) (*gitlab.MergeRequest, error) {
+	mr, _, err := c.MergeRequests.UpdateMergeRequest(pid, iid, &gitlab.UpdateMergeRequestOptions{
+		StateEvent: pString("close"),
+	})
+	return mr, err
+}
+
+func DeleteBranch(pid int, branch string) error {
+	_, err := c.Branches.DeleteBranch(pid, branch)
+	return err
+}
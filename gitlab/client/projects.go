@@ -0,0 +1,119 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"sasukebo/doo/gitlab/model"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// GetProject 通过项目ID或完整路径获取项目，附带存储统计信息
+func GetProject(pid interface{}) (*gitlab.Project, error) {
+	p, _, err := c.Projects.GetProject(pid, &gitlab.GetProjectOptions{Statistics: gitlab.Bool(true)})
+	return p, err
+}
+
+func HasCommitsSince(id int, since time.Time) (bool, error) {
+	cs, _, err := c.Commits.ListCommits(id, &gitlab.ListCommitsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 1, Page: 1},
+		Since:       gitlab.Time(since),
+		All:         gitlab.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(cs) > 0, nil
+}
+
+func HasMergeRequestsSince(id int, since time.Time) (bool, error) {
+	mrs, _, err := c.MergeRequests.ListProjectMergeRequests(id, &gitlab.ListProjectMergeRequestsOptions{
+		ListOptions:  gitlab.ListOptions{PerPage: 1, Page: 1},
+		UpdatedAfter: gitlab.Time(since),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(mrs) > 0, nil
+}
+
+func HasPipelinesSince(id int, since time.Time) (bool, error) {
+	ps, _, err := c.Pipelines.ListProjectPipelines(id, &gitlab.ListProjectPipelinesOptions{
+		ListOptions:  gitlab.ListOptions{PerPage: 1, Page: 1},
+		UpdatedAfter: gitlab.Time(since),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(ps) > 0, nil
+}
+
+func ArchiveProject(id int) error {
+	_, _, err := c.Projects.ArchiveProject(id)
+	return err
+}
+
+func UnarchiveProject(id int) error {
+	_, _, err := c.Projects.UnarchiveProject(id)
+	return err
+}
+
+// GetProjectStatistics 获取项目的存储统计，go-gitlab 的 Statistics 缺少 container_registry_size，所以这里直接请求
+func GetProjectStatistics(id int) (*model.ProjectStatistics, error) {
+	req, err := c.NewRequest(http.MethodGet, fmt.Sprintf("projects/%d", id), &gitlab.GetProjectOptions{Statistics: gitlab.Bool(true)}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		Statistics *model.ProjectStatistics `json:"statistics"`
+	}
+	if _, err = c.Do(req, &p); err != nil {
+		return nil, err
+	}
+	if p.Statistics == nil {
+		return &model.ProjectStatistics{}, nil
+	}
+	return p.Statistics, nil
+}
+
+// GetNeverExpireArtifacts 统计最近 pages 页任务中没有设置过期时间的产物数量及大小，pages 小于等于 0 时统计所有任务
+func GetNeverExpireArtifacts(id int, pages int) (int, int64, error) {
+	var (
+		count int
+		total int64
+		size  = 100
+	)
+	for page := 1; pages <= 0 || page <= pages; page++ {
+		jobs, _, err := c.Jobs.ListProjectJobs(id, &gitlab.ListJobsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, job := range jobs {
+			if job.ArtifactsExpireAt != nil || len(job.Artifacts) == 0 {
+				continue
+			}
+			count++
+			for _, a := range job.Artifacts {
+				total += int64(a.Size)
+			}
+		}
+		if len(jobs) < size {
+			break
+		}
+	}
+	return count, total, nil
+}
+
+func TransferProject(id int, namespace int) (*gitlab.Project, error) {
+	p, _, err := c.Projects.TransferProject(id, &gitlab.TransferProjectOptions{Namespace: namespace})
+	return p, err
+}
+
+// RenameProject 同时修改项目的名称和路径
+func RenameProject(id int, path string) (*gitlab.Project, error) {
+	p, _, err := c.Projects.EditProject(id, &gitlab.EditProjectOptions{Name: pString(path), Path: pString(path)})
+	return p, err
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// GetLatestTag 按版本号获取最新的标签，跳过 exclude，不存在时返回 nil。
+// gitlab 15.4 之前不支持按版本号排序，此时取提交时间最新的标签
+func GetLatestTag(pid int, exclude string) (*gitlab.Tag, error) {
+	tags, _, err := c.Tags.ListTags(pid, &gitlab.ListTagsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 10, Page: 1},
+		OrderBy:     pString("version"),
+		Sort:        pString("desc"),
+	})
+	if err == nil {
+		for _, t := range tags {
+			if t.Name != exclude {
+				return t, nil
+			}
+		}
+		return nil, nil
+	}
+
+	var (
+		latest *gitlab.Tag
+		size   = 100
+		page   = 1
+	)
+	for {
+		tags, _, err := c.Tags.ListTags(pid, &gitlab.ListTagsOptions{ListOptions: gitlab.ListOptions{PerPage: size, Page: page}})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tags {
+			if t.Name == exclude || t.Commit == nil || t.Commit.CommittedDate == nil {
+				continue
+			}
+			if latest == nil || t.Commit.CommittedDate.After(*latest.Commit.CommittedDate) {
+				latest = t
+			}
+		}
+		if len(tags) < size {
+			break
+		}
+		page++
+	}
+	return latest, nil
+}
+
+func GetTag(pid int, name string) (*gitlab.Tag, error) {
+	t, _, err := c.Tags.GetTag(pid, name)
+	return t, err
+}
+
+func CompareCommits(pid int, from, to string) ([]*gitlab.Commit, error) {
+	cmp, _, err := c.Repositories.Compare(pid, &gitlab.CompareOptions{From: pString(from), To: pString(to)})
+	if err != nil {
+		return nil, err
+	}
+	return cmp.Commits, nil
+}
+
+func GetRefCommits(pid int, ref string) ([]*gitlab.Commit, error) {
+	var (
+		outs []*gitlab.Commit
+		size = 100
+		page = 1
+	)
+	for {
+		cs, _, err := c.Commits.ListCommits(pid, &gitlab.ListCommitsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: size, Page: page},
+			RefName:     pString(ref),
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, cs...)
+		if len(cs) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+// GetMergedMergeRequests 获取 since 之后有更新的已合并的合并请求，since 为 nil 时获取全部
+func GetMergedMergeRequests(pid int, since *time.Time) ([]*gitlab.MergeRequest, error) {
+	var (
+		outs []*gitlab.MergeRequest
+		size = 100
+		page = 1
+	)
+	for {
+		mrs, _, err := c.MergeRequests.ListProjectMergeRequests(pid, &gitlab.ListProjectMergeRequestsOptions{
+			ListOptions:  gitlab.ListOptions{PerPage: size, Page: page},
+			State:        pString("merged"),
+			UpdatedAfter: since,
+		})
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, mrs...)
+		if len(mrs) < size {
+			break
+		}
+		page++
+	}
+	return outs, nil
+}
+
+func CreateTag(pid int, tag, ref, message string) (*gitlab.Tag, error) {
+	t, _, err := c.Tags.CreateTag(pid, &gitlab.CreateTagOptions{
+		TagName: pString(tag),
+		Ref:     pString(ref),
+		Message: pString(message),
+	})
+	return t, err
+}
+
+func CreateRelease(pid int, tag, name, description string) (*gitlab.Release, error) {
+	r, _, err := c.Releases.CreateRelease(pid, &gitlab.CreateReleaseOptions{
+		Name:        pString(name),
+		TagName:     pString(tag),
+		Description: pString(description),
+	})
+	return r, err
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// NewClient 创建访问另一个 gitlab 实例的客户端，host 不带协议时默认使用 https
+func NewClient(host, token string) (*Client, error) {
+	var baseURL = host
+	if !strings.Contains(host, "://") {
+		baseURL = "https://" + host
+	}
+	_c, err := gitlab.NewClient(token, gitlab.WithBaseURL(strings.TrimSuffix(baseURL, "/")+"/api/v4"))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: _c, host: host, token: token}, nil
+}
+
+// EnsureGroup 按完整路径获取分组，不存在时逐级创建
+func (t *Client) EnsureGroup(fullPath string) (*gitlab.Group, error) {
+	g, rsp, err := t.Groups.GetGroup(fullPath, nil)
+	if err == nil {
+		return g, nil
+	}
+	if rsp == nil || rsp.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	var parentID *int
+	if i := strings.LastIndex(fullPath, "/"); i >= 0 {
+		parent, err := t.EnsureGroup(fullPath[:i])
+		if err != nil {
+			return nil, err
+		}
+		parentID = &parent.ID
+	}
+	name := path.Base(fullPath)
+	g, _, err = t.Groups.CreateGroup(&gitlab.CreateGroupOptions{
+		Name:       pString(name),
+		Path:       pString(name),
+		ParentID:   parentID,
+		Visibility: gitlab.Visibility(gitlab.PrivateVisibility),
+	})
+	return g, err
+}
+
+// EnsureProject 获取分组下与 source 同路径的项目，不存在时创建
+func (t *Client) EnsureProject(group *gitlab.Group, source *gitlab.Project) (*gitlab.Project, error) {
+	p, rsp, err := t.Projects.GetProject(group.FullPath+"/"+source.Path, nil)
+	if err == nil {
+		return p, nil
+	}
+	if rsp == nil || rsp.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	p, _, err = t.Projects.CreateProject(&gitlab.CreateProjectOptions{
+		Name:        pString(source.Name),
+		Path:        pString(source.Path),
+		NamespaceID: &group.ID,
+		Description: pString(source.Description),
+		Visibility:  gitlab.Visibility(gitlab.PrivateVisibility),
+	})
+	return p, err
+}
@@ -0,0 +1,43 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// projectVariableOptions go-gitlab 的变量选项缺少 raw，值里的 $ 会被当成变量引用展开，所以这里直接请求
+type projectVariableOptions struct {
+	Key       *string `url:"key,omitempty" json:"key,omitempty"`
+	Value     *string `url:"value,omitempty" json:"value,omitempty"`
+	Masked    *bool   `url:"masked,omitempty" json:"masked,omitempty"`
+	Protected *bool   `url:"protected,omitempty" json:"protected,omitempty"`
+	Raw       *bool   `url:"raw,omitempty" json:"raw,omitempty"`
+}
+
+// SetProjectVariable 创建或更新项目的 CI/CD 变量，变量不展开，保留值里的 $ 原样
+func SetProjectVariable(pid interface{}, key, value string, masked, protected bool) error {
+	_, rsp, err := c.ProjectVariables.GetVariable(pid, key, nil)
+	if err != nil && (rsp == nil || rsp.StatusCode != http.StatusNotFound) {
+		return err
+	}
+	opt := &projectVariableOptions{
+		Value:     &value,
+		Masked:    &masked,
+		Protected: &protected,
+		Raw:       gitlab.Bool(true),
+	}
+	project := gitlab.PathEscape(fmt.Sprint(pid))
+	method, uri := http.MethodPut, fmt.Sprintf("projects/%s/variables/%s", project, gitlab.PathEscape(key))
+	if err != nil {
+		opt.Key = &key
+		method, uri = http.MethodPost, fmt.Sprintf("projects/%s/variables", project)
+	}
+	req, err := c.NewRequest(method, uri, opt, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(req, nil)
+	return err
+}
@@ -77,7 +77,7 @@ func GenerateLocalDirectories(ctx *cli.Context) error {
 }
 
 func cloneOrUpdateProjects(group *gitlab.Group, accessToken, root string) {
-	var auth = http.BasicAuth{Username: "thingyouwe", Password: accessToken}
+	var auth = gitAuth(accessToken)
 	projects, err := client.GetGroupProjects(group.ID)
 	if err != nil {
 		fmt.Printf("--- [ERROR] Get group projects failed: %v\n", err)
@@ -85,28 +85,44 @@ func cloneOrUpdateProjects(group *gitlab.Group, accessToken, root string) {
 	}
 	for _, project := range projects {
 		projectDir := fmt.Sprintf("%s/%s/%s", root, group.FullPath, project.Path)
-		if utils.IsDir(projectDir) {
-			fmt.Printf("--- [INFO] Pull project %s\n", project.Name)
-			if repo, err := git.PlainOpen(projectDir); err == nil {
-				if w, err := repo.Worktree(); err == nil {
-					if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(project.DefaultBranch)}); err == nil {
-						_ = w.Pull(&git.PullOptions{RemoteName: "origin", Auth: &auth})
+		_ = cloneOrUpdateProject(project, projectDir, auth)
+	}
+}
+
+// cloneOrUpdateProject 本地已存在时拉取默认分支的更新，否则克隆项目
+func cloneOrUpdateProject(project *gitlab.Project, projectDir string, auth *http.BasicAuth) error {
+	if utils.IsDir(projectDir) {
+		fmt.Printf("--- [INFO] Pull project %s\n", project.Name)
+		repo, err := git.PlainOpen(projectDir)
+		if err == nil {
+			var w *git.Worktree
+			if w, err = repo.Worktree(); err == nil {
+				if err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(project.DefaultBranch)}); err == nil {
+					if err = w.Pull(&git.PullOptions{RemoteName: "origin", Auth: auth}); err == git.NoErrAlreadyUpToDate {
+						err = nil
 					}
 				}
 			}
-			if err != nil {
-				fmt.Printf("--- [ERROR] Pull project %s for branch %s failed: %v\n", project.Name, project.DefaultBranch, err)
-			}
-		} else {
-			fmt.Printf("--- [INFO] Clone project %s\n", project.Name)
-			_, err := git.PlainClone(projectDir, false, &git.CloneOptions{
-				URL:               project.HTTPURLToRepo,
-				RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-				Auth:              &auth,
-			})
-			if err != nil {
-				fmt.Printf("--- [ERROR] Clone project %s failed: %v\n", project.Name, err)
-			}
 		}
+		if err != nil {
+			fmt.Printf("--- [ERROR] Pull project %s for branch %s failed: %v\n", project.Name, project.DefaultBranch, err)
+		}
+		return err
+	}
+
+	fmt.Printf("--- [INFO] Clone project %s\n", project.Name)
+	_, err := git.PlainClone(projectDir, false, &git.CloneOptions{
+		URL:               project.HTTPURLToRepo,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              auth,
+	})
+	if err != nil {
+		fmt.Printf("--- [ERROR] Clone project %s failed: %v\n", project.Name, err)
 	}
+	return err
+}
+
+// gitAuth 使用 personal access token 作为 http 密码访问 gitlab 仓库
+func gitAuth(accessToken string) *http.BasicAuth {
+	return &http.BasicAuth{Username: "thingyouwe", Password: accessToken}
 }
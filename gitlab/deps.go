@@ -0,0 +1,504 @@
+package gitlab
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// dependency 某个项目中声明的一条依赖
+type dependency struct {
+	Ecosystem string `json:"ecosystem"`
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Project   string `json:"project"`
+	File      string `json:"file"`
+}
+
+type moduleInventory struct {
+	Ecosystem string              `json:"ecosystem"`
+	Module    string              `json:"module"`
+	Skew      bool                `json:"skew"`
+	Versions  map[string][]string `json:"versions"`
+}
+
+// DependencyInventory 解析所有本地克隆中的 go.mod、package.json、requirements.txt 和 pyproject.toml，npm 依赖优先使用锁文件中的版本，
+// 汇总 module→version→projects 并标记版本不一致的依赖
+func DependencyInventory(ctx *cli.Context) error {
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" && format != "csv" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	var moduleExp *regexp.Regexp
+	if m := ctx.String("module"); m != "" {
+		if moduleExp, err = regexp.Compile(m); err != nil {
+			return err
+		}
+	}
+
+	repos, err := findLocalRepos(root, parseGroups(ctx), ctx.String("projects"))
+	if err != nil {
+		return err
+	}
+
+	var deps []*dependency
+	for _, repo := range repos {
+		ds, err := scanDependencies(repo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] Scan dependencies of %s failed: %v\n", repo, err)
+			continue
+		}
+		for _, d := range ds {
+			if moduleExp != nil && !moduleExp.MatchString(d.Module) {
+				continue
+			}
+			deps = append(deps, d)
+		}
+	}
+
+	// 版本在汇总之后再过滤，否则 --skew 和 --version 一起使用时看不到其他版本
+	var inventory []*moduleInventory
+	for _, m := range buildInventory(deps) {
+		if ctx.Bool("skew") && !m.Skew {
+			continue
+		}
+		if v := ctx.String("version"); v != "" && m.Versions[v] == nil {
+			continue
+		}
+		inventory = append(inventory, m)
+	}
+
+	var w io.Writer = os.Stdout
+	if output := ctx.String("output"); output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+
+	switch format {
+	case "json":
+		content, err := json.MarshalIndent(inventory, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(content))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"ecosystem", "module", "version", "project", "skew"})
+		for _, m := range inventory {
+			for _, v := range sortedVersions(m) {
+				for _, p := range m.Versions[v] {
+					_ = cw.Write([]string{m.Ecosystem, m.Module, v, p, fmt.Sprint(m.Skew)})
+				}
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	for _, m := range inventory {
+		var flag string
+		if m.Skew {
+			flag = " [SKEW]"
+		}
+		fmt.Fprintf(w, "*** %s %s%s ***\n", m.Ecosystem, m.Module, flag)
+		for _, v := range sortedVersions(m) {
+			fmt.Fprintf(w, "  %-20s %s\n", v, strings.Join(m.Versions[v], ", "))
+		}
+	}
+	return nil
+}
+
+func buildInventory(deps []*dependency) []*moduleInventory {
+	var modules = make(map[string]*moduleInventory)
+	for _, d := range deps {
+		key := d.Ecosystem + ":" + d.Module
+		m, ok := modules[key]
+		if !ok {
+			m = &moduleInventory{Ecosystem: d.Ecosystem, Module: d.Module, Versions: make(map[string][]string)}
+			modules[key] = m
+		}
+		var exist bool
+		for _, p := range m.Versions[d.Version] {
+			exist = exist || p == d.Project
+		}
+		if !exist {
+			m.Versions[d.Version] = append(m.Versions[d.Version], d.Project)
+		}
+	}
+
+	var outs []*moduleInventory
+	for _, m := range modules {
+		m.Skew = len(m.Versions) > 1
+		outs = append(outs, m)
+	}
+	sort.Slice(outs, func(i, j int) bool {
+		if outs[i].Ecosystem != outs[j].Ecosystem {
+			return outs[i].Ecosystem < outs[j].Ecosystem
+		}
+		return outs[i].Module < outs[j].Module
+	})
+	return outs
+}
+
+func sortedVersions(m *moduleInventory) []string {
+	var vs []string
+	for v := range m.Versions {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return vs
+}
+
+// scanDependencies 找出项目中被 git 管理的依赖文件并解析，无法解析的文件会被跳过
+func scanDependencies(repo *localRepo) ([]*dependency, error) {
+	out, err := runGit(repo.Dir, "ls-files")
+	if err != nil {
+		return nil, err
+	}
+
+	var deps []*dependency
+	for _, f := range strings.Split(out, "\n") {
+		if strings.Contains(f, "node_modules/") || strings.HasPrefix(f, "vendor/") {
+			continue
+		}
+		var (
+			ds  []*dependency
+			err error
+			p   = filepath.Join(repo.Dir, f)
+		)
+		switch name := path.Base(f); {
+		case name == "go.mod":
+			ds, err = parseGoMod(p)
+		case name == "package.json":
+			ds, err = parsePackageJSON(p)
+		case name == "pyproject.toml":
+			ds, err = parsePyproject(p)
+		case strings.HasPrefix(name, "requirements") && strings.HasSuffix(name, ".txt"):
+			ds, err = parseRequirements(p)
+		default:
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] Parse %s of %s failed: %v\n", f, repo, err)
+			continue
+		}
+		for _, d := range ds {
+			d.Project = repo.String()
+			d.File = f
+		}
+		deps = append(deps, ds...)
+	}
+	return deps, nil
+}
+
+func parseGoMod(file string) ([]*dependency, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var (
+		deps    []*dependency
+		inBlock bool
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "require (":
+			inBlock = true
+			continue
+		case inBlock && line == ")":
+			inBlock = false
+			continue
+		case strings.HasPrefix(line, "require "):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "require"))
+		case !inBlock:
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			deps = append(deps, &dependency{Ecosystem: "go", Module: fields[0], Version: fields[1]})
+		}
+	}
+	return deps, scanner.Err()
+}
+
+// parsePackageJSON 解析 package.json，同目录下有 package-lock.json、yarn.lock 或 pnpm-lock.yaml 时使用锁定的版本
+func parsePackageJSON(file string) ([]*dependency, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err = json.Unmarshal(content, &pkg); err != nil {
+		return nil, err
+	}
+	locked := parseNpmLock(filepath.Dir(file))
+
+	var deps []*dependency
+	for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies} {
+		for name, version := range m {
+			if v, ok := locked[name+"@"+version]; ok {
+				version = v
+			} else if v, ok := locked[name]; ok {
+				version = v
+			}
+			deps = append(deps, &dependency{Ecosystem: "npm", Module: name, Version: version})
+		}
+	}
+	return deps, nil
+}
+
+// parseNpmLock 读取目录下的锁文件，返回 name 或 name@range 到锁定版本的映射，无法解析时返回空
+func parseNpmLock(dir string) map[string]string {
+	if content, err := os.ReadFile(filepath.Join(dir, "package-lock.json")); err == nil {
+		return parsePackageLock(content)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "yarn.lock")); err == nil {
+		return parseYarnLock(content)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "pnpm-lock.yaml")); err == nil {
+		return parsePnpmLock(content)
+	}
+	return map[string]string{}
+}
+
+func parsePackageLock(content []byte) map[string]string {
+	var outs = make(map[string]string)
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if json.Unmarshal(content, &lock) != nil {
+		return outs
+	}
+	for name, p := range lock.Dependencies {
+		outs[name] = p.Version
+	}
+	for name, p := range lock.Packages {
+		if strings.HasPrefix(name, "node_modules/") && !strings.Contains(strings.TrimPrefix(name, "node_modules/"), "node_modules/") {
+			outs[strings.TrimPrefix(name, "node_modules/")] = p.Version
+		}
+	}
+	return outs
+}
+
+// parseYarnLock 解析 yarn.lock，兼容 yarn 1 的 version "x" 和 yarn 2+ 的 version: x
+func parseYarnLock(content []byte) map[string]string {
+	var (
+		outs  = make(map[string]string)
+		specs []string
+	)
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			specs = strings.Split(strings.TrimSuffix(line, ":"), ",")
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "version") || len(specs) == 0 {
+			continue
+		}
+		version := strings.Trim(strings.TrimSpace(strings.TrimLeft(trimmed[len("version"):], ": ")), `"`)
+		for _, spec := range specs {
+			spec = strings.Trim(strings.TrimSpace(spec), `"`)
+			i := strings.LastIndex(spec, "@")
+			if i <= 0 {
+				continue
+			}
+			name, rng := spec[:i], strings.TrimPrefix(spec[i+1:], "npm:")
+			outs[name+"@"+rng] = version
+			outs[name] = version
+		}
+		specs = nil
+	}
+	return outs
+}
+
+// parsePnpmLock 解析 pnpm-lock.yaml 中根项目的直接依赖，版本中的 peer 依赖后缀会被去掉
+func parsePnpmLock(content []byte) map[string]string {
+	type importer struct {
+		Dependencies         map[string]interface{} `yaml:"dependencies"`
+		DevDependencies      map[string]interface{} `yaml:"devDependencies"`
+		OptionalDependencies map[string]interface{} `yaml:"optionalDependencies"`
+	}
+	var lock struct {
+		importer  `yaml:",inline"`
+		Importers map[string]importer `yaml:"importers"`
+	}
+	var outs = make(map[string]string)
+	if yaml.Unmarshal(content, &lock) != nil {
+		return outs
+	}
+	for _, imp := range []importer{lock.importer, lock.Importers["."]} {
+		for _, m := range []map[string]interface{}{imp.Dependencies, imp.DevDependencies, imp.OptionalDependencies} {
+			for name, v := range m {
+				var version string
+				switch v := v.(type) {
+				case string:
+					version = v
+				case map[string]interface{}:
+					version, _ = v["version"].(string)
+				}
+				if i := strings.IndexAny(version, "(_"); i > 0 {
+					version = version[:i]
+				}
+				if version != "" {
+					outs[name] = version
+				}
+			}
+		}
+	}
+	return outs
+}
+
+var requirementExp = regexp.MustCompile(`^([A-Za-z0-9_.\-\[\]]+)\s*((?:[=<>!~]=?|===)\s*[^;#\s]+(?:\s*,\s*[=<>!~]=?\s*[^;#\s,]+)*)?`)
+
+var poetryVersionExp = regexp.MustCompile(`version\s*=\s*"([^"]*)"`)
+
+func parseRequirement(line string) *dependency {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-") {
+		return nil
+	}
+	m := requirementExp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	name := strings.ToLower(m[1])
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	version := strings.TrimPrefix(strings.ReplaceAll(m[2], " ", ""), "==")
+	if version == "" {
+		version = "*"
+	}
+	return &dependency{Ecosystem: "pypi", Module: name, Version: version}
+}
+
+func parseRequirements(file string) ([]*dependency, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var deps []*dependency
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if d := parseRequirement(scanner.Text()); d != nil {
+			deps = append(deps, d)
+		}
+	}
+	return deps, scanner.Err()
+}
+
+// parsePyproject 只解析 [project] 的 dependencies 数组和 [tool.poetry.dependencies] 表
+func parsePyproject(file string) ([]*dependency, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var (
+		deps    []*dependency
+		section string
+		inArray bool
+		scanner = bufio.NewScanner(f)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && !inArray {
+			section = strings.Trim(line, "[] ")
+			continue
+		}
+
+		switch section {
+		case "project":
+			if strings.HasPrefix(line, "dependencies") && strings.Contains(line, "[") {
+				inArray = true
+				line = line[strings.Index(line, "[")+1:]
+			}
+			if !inArray {
+				continue
+			}
+			if strings.Contains(line, "]") {
+				inArray = false
+				line = line[:strings.LastIndex(line, "]")]
+			}
+			for _, item := range strings.Split(line, ",") {
+				item = strings.Trim(strings.TrimSpace(item), `"'`)
+				if d := parseRequirement(item); d != nil {
+					deps = append(deps, d)
+				}
+			}
+		case "tool.poetry.dependencies", "tool.poetry.dev-dependencies":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			name := strings.ToLower(strings.TrimSpace(kv[0]))
+			if name == "python" {
+				continue
+			}
+			version := strings.TrimSpace(kv[1])
+			if strings.HasPrefix(version, "{") {
+				if m := poetryVersionExp.FindStringSubmatch(version); m != nil {
+					version = m[1]
+				} else {
+					version = "*"
+				}
+			}
+			deps = append(deps, &dependency{Ecosystem: "pypi", Module: name, Version: strings.Trim(version, `"'`)})
+		}
+	}
+	return deps, scanner.Err()
+}
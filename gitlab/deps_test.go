@@ -0,0 +1,140 @@
+package gitlab
+
+import (
+	"testing"
+)
+
+func TestParseYarnLock(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name: "yarn 1",
+			content: `# yarn lockfile v1
+
+"@babel/core@^7.0.0", "@babel/core@^7.1.0":
+  version "7.20.5"
+  resolved "https://registry.yarnpkg.com/@babel/core/-/core-7.20.5.tgz"
+
+lodash@^4.17.0:
+  version "4.17.21"
+`,
+			want: map[string]string{
+				"@babel/core@^7.0.0": "7.20.5",
+				"@babel/core@^7.1.0": "7.20.5",
+				"@babel/core":        "7.20.5",
+				"lodash@^4.17.0":     "4.17.21",
+				"lodash":             "4.17.21",
+			},
+		},
+		{
+			name: "yarn 2",
+			content: `__metadata:
+  version: 6
+
+"react@npm:^18.2.0":
+  version: 18.2.0
+  resolution: "react@npm:18.2.0"
+`,
+			want: map[string]string{
+				"react@^18.2.0": "18.2.0",
+				"react":         "18.2.0",
+			},
+		},
+	}
+	for _, c := range cases {
+		got := parseYarnLock([]byte(c.content))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", c.name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestParsePnpmLock(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name: "lockfile v5",
+			content: `lockfileVersion: 5.4
+dependencies:
+  react: 18.2.0
+  react-dom: 18.2.0_react@18.2.0
+devDependencies:
+  typescript: 4.9.4
+`,
+			want: map[string]string{"react": "18.2.0", "react-dom": "18.2.0", "typescript": "4.9.4"},
+		},
+		{
+			name: "lockfile v6 importers",
+			content: `lockfileVersion: '6.0'
+importers:
+  .:
+    dependencies:
+      react-dom:
+        specifier: ^18.2.0
+        version: 18.2.0(react@18.2.0)
+  packages/app:
+    dependencies:
+      vue:
+        specifier: ^3.0.0
+        version: 3.2.45
+`,
+			want: map[string]string{"react-dom": "18.2.0"},
+		},
+		{
+			name:    "invalid",
+			content: "dependencies: [",
+			want:    map[string]string{},
+		},
+	}
+	for _, c := range cases {
+		got := parsePnpmLock([]byte(c.content))
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("%s: %s = %q, want %q", c.name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestParseRequirement(t *testing.T) {
+	cases := []struct {
+		line, module, version string
+	}{
+		{"Django>=3.2,<4.0", "django", ">=3.2,<4.0"},
+		{"requests[security]==2.28.1", "requests", "2.28.1"},
+		{"numpy", "numpy", "*"},
+		{"flask == 2.2.2 ; python_version >= '3.7'", "flask", "2.2.2"},
+		{"pytest~=7.2  # test only", "pytest", "~=7.2"},
+		{"# comment", "", ""},
+		{"-r base.txt", "", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		d := parseRequirement(c.line)
+		if c.module == "" {
+			if d != nil {
+				t.Errorf("parseRequirement(%q) = %+v, want nil", c.line, d)
+			}
+			continue
+		}
+		if d == nil || d.Module != c.module || d.Version != c.version {
+			t.Errorf("parseRequirement(%q) = %+v, want %s %s", c.line, d, c.module, c.version)
+		}
+	}
+}
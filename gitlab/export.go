@@ -0,0 +1,353 @@
+package gitlab
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+type exportedIssue struct {
+	Issue *gitlab.Issue  `json:"issue"`
+	Notes []*gitlab.Note `json:"notes"`
+}
+
+type exportedMergeRequest struct {
+	MergeRequest *gitlab.MergeRequest `json:"merge_request"`
+	Notes        []*gitlab.Note       `json:"notes"`
+}
+
+type exportState struct {
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// ExportProjects 将议题、合并请求、评论、标签和里程碑以 JSON lines 导出到本地克隆旁的 <project>.export 目录，
+// 再次执行时只拉取上次导出后有更新的内容，并渲染成 Markdown
+func ExportProjects(ctx *cli.Context) error {
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return err
+	}
+
+	if ctx.Bool("render") {
+		repos, err := findLocalRepos(root, parseGroups(ctx), ctx.String("projects"))
+		if err != nil {
+			return err
+		}
+		var failed int
+		for _, repo := range repos {
+			dir := repo.Dir + ".export"
+			if !utils.IsDir(dir) {
+				continue
+			}
+			if err := renderExport(dir, repo.String()); err != nil {
+				fmt.Fprintf(os.Stderr, "--- [ERROR] Render %s failed: %v\n", dir, err)
+				failed++
+			}
+		}
+		return exportFailed(failed)
+	}
+
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+	groups, err := selectGroups(ctx)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, group := range groups {
+		projects, err := client.GetGroupProjects(group.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+			failed++
+			continue
+		}
+		for _, project := range projects {
+			if !matchProject(project.Path, ctx.String("projects")) {
+				continue
+			}
+			dir := fmt.Sprintf("%s/%s/%s.export", root, group.FullPath, project.Path)
+			fmt.Printf("--- [INFO] Export project %s to %s\n", project.PathWithNamespace, dir)
+			if err := exportProject(project, dir); err != nil {
+				fmt.Fprintf(os.Stderr, "--- [ERROR] Export project %s failed: %v\n", project.PathWithNamespace, err)
+				failed++
+				continue
+			}
+			if err := renderExport(dir, project.PathWithNamespace); err != nil {
+				fmt.Fprintf(os.Stderr, "--- [ERROR] Render %s failed: %v\n", dir, err)
+				failed++
+			}
+		}
+	}
+	return exportFailed(failed)
+}
+
+func exportFailed(failed int) error {
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "--- [ERROR] %v exports failed\n", failed)
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func exportProject(project *gitlab.Project, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var state exportState
+	_ = readJSON(filepath.Join(dir, "export.json"), &state)
+
+	labels, err := client.GetProjectLabels(project.ID)
+	if err != nil {
+		return err
+	}
+	if err = writeJSONLines(filepath.Join(dir, "labels.jsonl"), labels); err != nil {
+		return err
+	}
+	milestones, err := client.GetProjectMilestones(project.ID)
+	if err != nil {
+		return err
+	}
+	if err = writeJSONLines(filepath.Join(dir, "milestones.jsonl"), milestones); err != nil {
+		return err
+	}
+
+	var issues = make(map[int]*exportedIssue)
+	if err = readJSONLines(filepath.Join(dir, "issues.jsonl"), func(line []byte) error {
+		var i exportedIssue
+		if err := json.Unmarshal(line, &i); err != nil {
+			return err
+		}
+		issues[i.Issue.IID] = &i
+		return nil
+	}); err != nil {
+		return err
+	}
+	updatedIssues, err := client.GetProjectIssues(project.ID, state.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	for _, issue := range updatedIssues {
+		notes, err := client.GetIssueNotes(project.ID, issue.IID)
+		if err != nil {
+			return err
+		}
+		issues[issue.IID] = &exportedIssue{Issue: issue, Notes: notes}
+	}
+	var issueList []*exportedIssue
+	for _, i := range issues {
+		issueList = append(issueList, i)
+	}
+	sort.Slice(issueList, func(i, j int) bool { return issueList[i].Issue.IID < issueList[j].Issue.IID })
+	if err = writeJSONLines(filepath.Join(dir, "issues.jsonl"), issueList); err != nil {
+		return err
+	}
+
+	var mrs = make(map[int]*exportedMergeRequest)
+	if err = readJSONLines(filepath.Join(dir, "merge_requests.jsonl"), func(line []byte) error {
+		var mr exportedMergeRequest
+		if err := json.Unmarshal(line, &mr); err != nil {
+			return err
+		}
+		mrs[mr.MergeRequest.IID] = &mr
+		return nil
+	}); err != nil {
+		return err
+	}
+	updatedMRs, err := client.GetProjectMergeRequests(project.ID, state.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	for _, mr := range updatedMRs {
+		notes, err := client.GetMergeRequestNotes(project.ID, mr.IID)
+		if err != nil {
+			return err
+		}
+		mrs[mr.IID] = &exportedMergeRequest{MergeRequest: mr, Notes: notes}
+	}
+	var mrList []*exportedMergeRequest
+	for _, mr := range mrs {
+		mrList = append(mrList, mr)
+	}
+	sort.Slice(mrList, func(i, j int) bool { return mrList[i].MergeRequest.IID < mrList[j].MergeRequest.IID })
+	if err = writeJSONLines(filepath.Join(dir, "merge_requests.jsonl"), mrList); err != nil {
+		return err
+	}
+
+	fmt.Printf("--- [INFO] %v issues and %v merge requests updated\n", len(updatedIssues), len(updatedMRs))
+	// 下次从导出数据中最新的 updated_at 开始，使用服务端时间，避免本地时钟偏差漏掉更新
+	for _, i := range issueList {
+		state.UpdatedAt = laterTime(state.UpdatedAt, i.Issue.UpdatedAt)
+	}
+	for _, mr := range mrList {
+		state.UpdatedAt = laterTime(state.UpdatedAt, mr.MergeRequest.UpdatedAt)
+	}
+	content, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "export.json"), content, 0644)
+}
+
+func laterTime(a, b *time.Time) *time.Time {
+	if b != nil && (a == nil || b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// renderExport 将导出的 JSON lines 渲染为 Markdown，便于脱离 gitlab 阅读
+func renderExport(dir, name string) error {
+	var index strings.Builder
+	fmt.Fprintf(&index, "# %s\n\n", name)
+
+	index.WriteString("## Issues\n\n")
+	if err := os.MkdirAll(filepath.Join(dir, "markdown", "issues"), 0755); err != nil {
+		return err
+	}
+	err := readJSONLines(filepath.Join(dir, "issues.jsonl"), func(line []byte) error {
+		var i exportedIssue
+		if err := json.Unmarshal(line, &i); err != nil {
+			return err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "# #%v %s\n\n", i.Issue.IID, i.Issue.Title)
+		fmt.Fprintf(&b, "- State: %s\n", i.Issue.State)
+		if i.Issue.Author != nil {
+			fmt.Fprintf(&b, "- Author: @%s\n", i.Issue.Author.Username)
+		}
+		fmt.Fprintf(&b, "- Created: %s\n", formatTime(i.Issue.CreatedAt))
+		if len(i.Issue.Labels) > 0 {
+			fmt.Fprintf(&b, "- Labels: %s\n", strings.Join(i.Issue.Labels, ", "))
+		}
+		if i.Issue.Milestone != nil {
+			fmt.Fprintf(&b, "- Milestone: %s\n", i.Issue.Milestone.Title)
+		}
+		fmt.Fprintf(&b, "- URL: %s\n\n%s\n", i.Issue.WebURL, i.Issue.Description)
+		renderNotes(&b, i.Notes)
+
+		file := fmt.Sprintf("issues/%v.md", i.Issue.IID)
+		fmt.Fprintf(&index, "- [#%v %s](%s) %s\n", i.Issue.IID, i.Issue.Title, file, i.Issue.State)
+		return os.WriteFile(filepath.Join(dir, "markdown", file), []byte(b.String()), 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	index.WriteString("\n## Merge Requests\n\n")
+	if err = os.MkdirAll(filepath.Join(dir, "markdown", "merge_requests"), 0755); err != nil {
+		return err
+	}
+	err = readJSONLines(filepath.Join(dir, "merge_requests.jsonl"), func(line []byte) error {
+		var mr exportedMergeRequest
+		if err := json.Unmarshal(line, &mr); err != nil {
+			return err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "# !%v %s\n\n", mr.MergeRequest.IID, mr.MergeRequest.Title)
+		fmt.Fprintf(&b, "- State: %s\n", mr.MergeRequest.State)
+		if mr.MergeRequest.Author != nil {
+			fmt.Fprintf(&b, "- Author: @%s\n", mr.MergeRequest.Author.Username)
+		}
+		fmt.Fprintf(&b, "- Branch: %s → %s\n", mr.MergeRequest.SourceBranch, mr.MergeRequest.TargetBranch)
+		fmt.Fprintf(&b, "- Created: %s\n", formatTime(mr.MergeRequest.CreatedAt))
+		if len(mr.MergeRequest.Labels) > 0 {
+			fmt.Fprintf(&b, "- Labels: %s\n", strings.Join(mr.MergeRequest.Labels, ", "))
+		}
+		fmt.Fprintf(&b, "- URL: %s\n\n%s\n", mr.MergeRequest.WebURL, mr.MergeRequest.Description)
+		renderNotes(&b, mr.Notes)
+
+		file := fmt.Sprintf("merge_requests/%v.md", mr.MergeRequest.IID)
+		fmt.Fprintf(&index, "- [!%v %s](%s) %s\n", mr.MergeRequest.IID, mr.MergeRequest.Title, file, mr.MergeRequest.State)
+		return os.WriteFile(filepath.Join(dir, "markdown", file), []byte(b.String()), 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, "markdown", "README.md"), []byte(index.String()), 0644)
+}
+
+func renderNotes(b *strings.Builder, notes []*gitlab.Note) {
+	if len(notes) == 0 {
+		return
+	}
+	b.WriteString("\n## Notes\n")
+	for _, n := range notes {
+		if n.System {
+			fmt.Fprintf(b, "\n*@%s %s %s*\n", n.Author.Username, n.Body, formatTime(n.CreatedAt))
+			continue
+		}
+		fmt.Fprintf(b, "\n### @%s %s\n\n%s\n", n.Author.Username, formatTime(n.CreatedAt), n.Body)
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func readJSON(file string, v interface{}) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// readJSONLines 逐行读取 JSON lines 文件，文件不存在时不做任何处理
+func readJSONLines(file string, fn func(line []byte) error) error {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func writeJSONLines[T any](file string, items []T) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
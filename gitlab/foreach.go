@@ -0,0 +1,173 @@
+package gitlab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sasukebo/doo/utils"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+type foreachResult struct {
+	Repo     *localRepo
+	ExitCode int
+	Err      error
+}
+
+// Foreach 在每个已同步的本地克隆中执行 shell 命令，并汇总退出码。
+// 只有一个参数时作为 shell 脚本执行，可以使用管道等语法；多个参数时按参数原样执行，保留参数中的空格
+func Foreach(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("usage: doo gitlab foreach [--groups] -- <cmd>")
+	}
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return err
+	}
+
+	repos, err := findLocalRepos(root, parseGroups(ctx), ctx.String("projects"))
+	if err != nil {
+		return err
+	}
+	if glob := ctx.String("if-exists"); glob != "" {
+		repos = filterReposByGlob(repos, glob)
+	}
+	if len(repos) == 0 {
+		fmt.Println("no project matched")
+		return nil
+	}
+
+	var (
+		command = shellCommand(ctx.Args().Slice())
+		jobs    = ctx.Int("jobs")
+		results = make([]*foreachResult, len(repos))
+		idxCh   = make(chan int)
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range idxCh {
+				repo := repos[idx]
+				stdout := &prefixWriter{prefix: "[" + repo.String() + "] ", w: os.Stdout, mu: &mu}
+				stderr := &prefixWriter{prefix: "[" + repo.String() + "] ", w: os.Stderr, mu: &mu}
+				results[idx] = runInRepo(repo, command, stdout, stderr)
+				stdout.Flush()
+				stderr.Flush()
+			}
+		}()
+	}
+	for i := range repos {
+		idxCh <- i
+	}
+	close(idxCh)
+	wg.Wait()
+
+	var failed int
+	fmt.Printf("\n*** Summary: %s ***\n", command)
+	for _, r := range results {
+		if r.ExitCode == 0 {
+			continue
+		}
+		failed++
+		if r.Err != nil {
+			fmt.Printf("  %-60s exit %v: %v\n", r.Repo, r.ExitCode, r.Err)
+		} else {
+			fmt.Printf("  %-60s exit %v\n", r.Repo, r.ExitCode)
+		}
+	}
+	fmt.Printf("  total: %v, succeeded: %v, failed: %v\n", len(results), len(results)-failed, failed)
+	if failed > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+// shellCommand 多个参数时逐个加上单引号再拼接，避免 sh -c 重新拆分参数
+func shellCommand(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'"'"'`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+func runInRepo(repo *localRepo, command string, stdout, stderr io.Writer) *foreachResult {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = repo.Dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = append(os.Environ(), "DOO_GROUP="+repo.Group, "DOO_PROJECT="+repo.Project)
+
+	var result = &foreachResult{Repo: repo}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			result.ExitCode = exitErr.ExitCode()
+		} else {
+			result.ExitCode = -1
+			result.Err = err
+		}
+	}
+	return result
+}
+
+// filterReposByGlob 只保留包含匹配 glob 文件的项目，如 go.mod 或 */Dockerfile
+func filterReposByGlob(repos []*localRepo, glob string) []*localRepo {
+	var outs []*localRepo
+	for _, repo := range repos {
+		if matches, _ := filepath.Glob(filepath.Join(repo.Dir, glob)); len(matches) > 0 {
+			outs = append(outs, repo)
+		}
+	}
+	return outs
+}
+
+// prefixWriter 按行给输出加上项目前缀，多个项目并行输出时不会交错在同一行
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+	for {
+		idx := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		line := p.buf.Next(idx + 1)
+		p.mu.Lock()
+		_, _ = fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+		p.mu.Unlock()
+	}
+	return len(b), nil
+}
+
+func (p *prefixWriter) Flush() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	p.mu.Lock()
+	_, _ = fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf.String())
+	p.mu.Unlock()
+	p.buf.Reset()
+}
@@ -0,0 +1,23 @@
+package gitlab
+
+import (
+	"testing"
+)
+
+func TestShellCommand(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"git status && make"}, "git status && make"},
+		{[]string{"git", "commit", "-m", "fix bug"}, `'git' 'commit' '-m' 'fix bug'`},
+		{[]string{"echo", "it's"}, `'echo' 'it'"'"'s'`},
+		{[]string{"grep", "-r", "$HOME"}, `'grep' '-r' '$HOME'`},
+		{[]string{"echo", ""}, `'echo' ''`},
+	}
+	for _, c := range cases {
+		if got := shellCommand(c.args); got != c.want {
+			t.Errorf("shellCommand(%q) = %s, want %s", c.args, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package gitlab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sasukebo/doo/utils"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/urfave/cli/v2"
+)
+
+var languageExts = map[string][]string{
+	"go":         {".go"},
+	"python":     {".py"},
+	"javascript": {".js", ".jsx", ".mjs", ".vue"},
+	"typescript": {".ts", ".tsx"},
+	"java":       {".java"},
+	"shell":      {".sh", ".bash", ".zsh"},
+	"lua":        {".lua"},
+	"proto":      {".proto"},
+	"sql":        {".sql"},
+	"yaml":       {".yaml", ".yml"},
+	"css":        {".css", ".scss", ".styl", ".wxss"},
+	"html":       {".html", ".wxml"},
+}
+
+// Grep 在所有已同步的本地克隆中并行搜索正则表达式，输出 group/project:path:line:content
+func Grep(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("regex required")
+	}
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return err
+	}
+
+	expr := ctx.Args().Get(0)
+	if ctx.Bool("ignore-case") {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+
+	var exts = make(map[string]struct{})
+	for _, lang := range strings.Split(ctx.String("lang"), ",") {
+		if lang == "" {
+			continue
+		}
+		es, ok := languageExts[strings.ToLower(lang)]
+		if !ok {
+			return fmt.Errorf("unsupported language %s", lang)
+		}
+		for _, e := range es {
+			exts[e] = struct{}{}
+		}
+	}
+
+	repos, err := findLocalRepos(root, parseGroups(ctx), ctx.String("projects"))
+	if err != nil {
+		return err
+	}
+
+	var (
+		branch  = ctx.String("branch")
+		jobs    = ctx.Int("jobs")
+		repoCh  = make(chan *localRepo)
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		matched int
+	)
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repo := range repoCh {
+				var (
+					lines []string
+					err   error
+				)
+				if branch == "" {
+					lines, err = grepWorktree(repo, re, exts)
+				} else {
+					lines, err = grepRef(repo, branch, re, exts)
+				}
+
+				mu.Lock()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "--- [ERROR] grep %s failed: %v\n", repo, err)
+				}
+				for _, line := range lines {
+					fmt.Println(line)
+				}
+				matched += len(lines)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, repo := range repos {
+		repoCh <- repo
+	}
+	close(repoCh)
+	wg.Wait()
+
+	if matched == 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func grepWorktree(repo *localRepo, re *regexp.Regexp, exts map[string]struct{}) ([]string, error) {
+	var b bytes.Buffer
+	cmd := exec.Command("git", "ls-files")
+	cmd.Dir = repo.Dir
+	cmd.Stdout = &b
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	var outs []string
+	for _, f := range strings.Split(b.String(), "\n") {
+		if f == "" || !matchExt(f, exts) {
+			continue
+		}
+		file, err := os.Open(filepath.Join(repo.Dir, f))
+		if err != nil {
+			continue
+		}
+		outs = append(outs, grepReader(repo.String()+":"+f, file, re)...)
+		_ = file.Close()
+	}
+	return outs, nil
+}
+
+// grepRef 通过 go-git 搜索未检出的分支，优先使用本地分支，其次是 origin 上的远程分支
+func grepRef(repo *localRepo, branch string, re *regexp.Regexp, exts map[string]struct{}) ([]string, error) {
+	r, err := git.PlainOpen(repo.Dir)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := r.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		ref, err = r.Reference(plumbing.NewRemoteReferenceName("origin", branch), true)
+	}
+	if err != nil {
+		// 分支不存在时跳过该项目
+		return nil, nil
+	}
+	commit, err := r.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+	files, err := commit.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var outs []string
+	err = files.ForEach(func(f *object.File) error {
+		if !matchExt(f.Name, exts) {
+			return nil
+		}
+		if bin, err := f.IsBinary(); err != nil || bin {
+			return nil
+		}
+		reader, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		outs = append(outs, grepReader(repo.String()+":"+f.Name, reader, re)...)
+		return nil
+	})
+	return outs, err
+}
+
+func grepReader(prefix string, r io.Reader, re *regexp.Regexp) []string {
+	var outs []string
+	br := bufio.NewReader(r)
+	// 检查开头是否包含空字节，跳过二进制文件
+	if head, _ := br.Peek(8000); bytes.IndexByte(head, 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var n int
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+		if re.MatchString(line) {
+			outs = append(outs, fmt.Sprintf("%s:%d:%s", prefix, n, line))
+		}
+	}
+	return outs
+}
+
+func matchExt(file string, exts map[string]struct{}) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	_, ok := exts[filepath.Ext(file)]
+	return ok
+}
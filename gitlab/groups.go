@@ -0,0 +1,41 @@
+package gitlab
+
+import (
+	"sasukebo/doo/gitlab/client"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+// selectGroups 获取远程分组，指定了 --groups 时只保留 FullPath 匹配的分组
+func selectGroups(ctx *cli.Context) ([]*gitlab.Group, error) {
+	gs := parseGroups(ctx)
+	groups, err := client.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+	if len(gs) == 0 {
+		return groups, nil
+	}
+
+	var outs []*gitlab.Group
+	for _, group := range groups {
+		if _, ok := gs[group.FullPath]; ok {
+			outs = append(outs, group)
+		}
+	}
+	return outs, nil
+}
+
+// parseGroups 解析逗号分隔的 --groups 参数
+func parseGroups(ctx *cli.Context) map[string]struct{} {
+	var gs = make(map[string]struct{})
+	for _, group := range strings.Split(ctx.String("groups"), ",") {
+		if group == "" {
+			continue
+		}
+		gs[group] = struct{}{}
+	}
+	return gs
+}
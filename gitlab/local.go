@@ -0,0 +1,83 @@
+package gitlab
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+)
+
+// localRepo 同步根目录下的一个本地克隆，目录结构为 root/group.FullPath/project.Path
+type localRepo struct {
+	Group   string
+	Project string
+	Dir     string
+}
+
+func (r *localRepo) String() string {
+	return r.Group + "/" + r.Project
+}
+
+// findLocalRepos 找出同步根目录下所有的本地克隆，groups 不为空时只保留这些分组及其子分组，
+// projects 不为空时按 glob 匹配项目路径
+func findLocalRepos(root string, groups map[string]struct{}, projects string) ([]*localRepo, error) {
+	var outs []*localRepo
+	root = filepath.Clean(root)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || p == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !utils.IsDir(filepath.Join(p, ".git")) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		repo := &localRepo{Group: path.Dir(rel), Project: path.Base(rel), Dir: p}
+		if repo.Group != "." && matchGroup(repo.Group, groups) && matchProject(repo.Project, projects) {
+			outs = append(outs, repo)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(outs, func(i, j int) bool { return outs[i].String() < outs[j].String() })
+	return outs, nil
+}
+
+func matchGroup(group string, groups map[string]struct{}) bool {
+	if len(groups) == 0 {
+		return true
+	}
+	for g := range groups {
+		if group == g || strings.HasPrefix(group, g+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchProject(project, pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	for _, p := range strings.Split(pattern, ",") {
+		if ok, _ := path.Match(p, project); ok {
+			return true
+		}
+	}
+	return false
+}
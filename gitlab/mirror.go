@@ -0,0 +1,291 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+var mirrorRefSpecs = []config.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+// mirrorTarget 镜像目标，可以是另一个 gitlab 实例，也可以是 github 或 gitea
+type mirrorTarget struct {
+	kind    string
+	baseURL string
+	token   string
+	auth    *githttp.BasicAuth
+	prefix  string
+	gitlab  *client.Client
+	// login github 令牌对应的用户名，用于判断目标是否为个人命名空间
+	login string
+}
+
+// Mirror 将源 gitlab 的分组和项目镜像到目标实例，推送所有分支和标签，本地缓存裸仓库用于增量更新
+func Mirror(ctx *cli.Context) error {
+	accessToken, err := utils.MustGetStringArg(ctx, "access_token", "DOO_GITLAB_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+	target, err := newMirrorTarget(ctx)
+	if err != nil {
+		return err
+	}
+	cache := ctx.String("cache")
+	if cache == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		cache = filepath.Join(dir, "doo", "mirror")
+	}
+
+	groups, err := selectGroups(ctx)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, group := range groups {
+		projects, err := client.GetGroupProjects(group.ID)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+			continue
+		}
+		for _, project := range projects {
+			if !matchProject(project.Path, ctx.String("projects")) {
+				continue
+			}
+			if ctx.Bool("dry-run") {
+				fmt.Printf("[DRY-RUN] mirror %s to %s\n", project.PathWithNamespace, target.path(group, project))
+				continue
+			}
+			fmt.Printf("--- [INFO] Mirror project %s\n", project.PathWithNamespace)
+			if err := mirrorProject(cache, group, project, gitAuth(accessToken), target); err != nil {
+				fmt.Printf("--- [ERROR] Mirror project %s failed: %v\n", project.PathWithNamespace, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("mirror failed for %v projects", failed)
+	}
+	return nil
+}
+
+func newMirrorTarget(ctx *cli.Context) (*mirrorTarget, error) {
+	host, err := utils.MustGetStringArg(ctx, "to", "")
+	if err != nil {
+		return nil, err
+	}
+	token, err := utils.MustGetStringArg(ctx, "to-token", "DOO_GITLAB_MIRROR_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	var baseURL = strings.TrimSuffix(host, "/")
+	if !strings.Contains(host, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	t := &mirrorTarget{
+		kind:    ctx.String("to-type"),
+		baseURL: baseURL,
+		token:   token,
+		auth:    &githttp.BasicAuth{Username: ctx.String("to-user"), Password: token},
+		prefix:  strings.Trim(ctx.String("namespace"), "/"),
+	}
+	switch t.kind {
+	case "gitlab":
+		if t.gitlab, err = client.NewClient(host, token); err != nil {
+			return nil, err
+		}
+	case "github", "gitea":
+	default:
+		return nil, fmt.Errorf("unsupported target type %s", t.kind)
+	}
+	return t, nil
+}
+
+// path 返回项目在目标上的路径，github 和 gitea 不支持嵌套分组，使用 - 拼接分组路径作为组织名
+func (t *mirrorTarget) path(group *gitlab.Group, project *gitlab.Project) string {
+	var namespace = group.FullPath
+	if t.prefix != "" {
+		namespace = t.prefix + "/" + namespace
+	}
+	if t.kind != "gitlab" {
+		namespace = strings.ReplaceAll(namespace, "/", "-")
+	}
+	return namespace + "/" + project.Path
+}
+
+// ensure 确保目标上存在对应的项目，返回推送地址
+func (t *mirrorTarget) ensure(group *gitlab.Group, project *gitlab.Project) (string, error) {
+	p := t.path(group, project)
+	namespace := p[:strings.LastIndex(p, "/")]
+
+	if t.kind == "gitlab" {
+		g, err := t.gitlab.EnsureGroup(namespace)
+		if err != nil {
+			return "", fmt.Errorf("ensure group %s failed: %v", namespace, err)
+		}
+		tp, err := t.gitlab.EnsureProject(g, project)
+		if err != nil {
+			return "", fmt.Errorf("ensure project %s failed: %v", p, err)
+		}
+		return tp.HTTPURLToRepo, nil
+	}
+
+	var api = t.baseURL + "/api/v1"
+	if t.kind == "github" {
+		api = t.baseURL + "/api/v3"
+		if strings.HasSuffix(t.baseURL, "://github.com") {
+			api = "https://api.github.com"
+		}
+	}
+	status, _, err := t.request(http.MethodGet, fmt.Sprintf("%s/repos/%s", api, p), nil)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound {
+		if t.kind == "gitea" {
+			status, content, err := t.request(http.MethodGet, fmt.Sprintf("%s/orgs/%s", api, namespace), nil)
+			if err != nil {
+				return "", err
+			}
+			if status == http.StatusNotFound {
+				status, content, err = t.request(http.MethodPost, api+"/orgs", map[string]interface{}{"username": namespace})
+				if err != nil {
+					return "", err
+				}
+			}
+			if status >= 300 {
+				return "", fmt.Errorf("ensure org %s failed: %s", namespace, string(content))
+			}
+		}
+		var createURI = fmt.Sprintf("%s/orgs/%s/repos", api, namespace)
+		if t.kind == "github" {
+			if createURI, err = t.githubCreateURI(api, namespace); err != nil {
+				return "", err
+			}
+		}
+		status, content, err := t.request(http.MethodPost, createURI, map[string]interface{}{
+			"name":        project.Path,
+			"description": project.Description,
+			"private":     true,
+		})
+		if err != nil {
+			return "", err
+		}
+		if status >= 300 {
+			return "", fmt.Errorf("create repo %s failed: %s", p, string(content))
+		}
+	}
+	return fmt.Sprintf("%s/%s.git", t.baseURL, p), nil
+}
+
+// githubCreateURI 目标为令牌对应的用户时在个人命名空间下创建仓库，否则要求组织已经存在
+func (t *mirrorTarget) githubCreateURI(api, namespace string) (string, error) {
+	if t.login == "" {
+		status, content, err := t.request(http.MethodGet, api+"/user", nil)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusOK {
+			return "", fmt.Errorf("get github user failed: %s", string(content))
+		}
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err = json.Unmarshal(content, &user); err != nil {
+			return "", err
+		}
+		t.login = user.Login
+	}
+	if strings.EqualFold(t.login, namespace) {
+		return api + "/user/repos", nil
+	}
+
+	status, content, err := t.request(http.MethodGet, fmt.Sprintf("%s/orgs/%s", api, namespace), nil)
+	if err != nil {
+		return "", err
+	}
+	if status == http.StatusNotFound {
+		return "", fmt.Errorf("github org %s not found, create it first or mirror to your own namespace %s", namespace, t.login)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("get github org %s failed: %s", namespace, string(content))
+	}
+	return fmt.Sprintf("%s/orgs/%s/repos", api, namespace), nil
+}
+
+func (t *mirrorTarget) request(method, uri string, data interface{}) (int, []byte, error) {
+	var buf bytes.Buffer
+	if data != nil {
+		if err := json.NewEncoder(&buf).Encode(data); err != nil {
+			return 0, nil, err
+		}
+	}
+	req, err := http.NewRequest(method, uri, &buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "token "+t.token)
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	content, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	return rsp.StatusCode, content, nil
+}
+
+// mirrorProject 将源项目拉取到本地缓存的裸仓库，再推送所有分支和标签到目标
+func mirrorProject(cache string, group *gitlab.Group, project *gitlab.Project, auth *githttp.BasicAuth, target *mirrorTarget) error {
+	pushURL, err := target.ensure(group, project)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(cache, project.PathWithNamespace+".git")
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		if repo, err = git.PlainInit(dir, true); err == nil {
+			_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{project.HTTPURLToRepo}, Fetch: mirrorRefSpecs})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = repo.Fetch(&git.FetchOptions{RemoteName: "origin", RefSpecs: mirrorRefSpecs, Auth: auth, Force: true})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("fetch failed: %v", err)
+	}
+
+	// 目标地址可能变化，每次重新创建 mirror 远程
+	_ = repo.DeleteRemote("mirror")
+	if _, err = repo.CreateRemote(&config.RemoteConfig{Name: "mirror", URLs: []string{pushURL}}); err != nil {
+		return err
+	}
+	err = repo.Push(&git.PushOptions{RemoteName: "mirror", RefSpecs: mirrorRefSpecs, Auth: target.auth})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("push failed: %v", err)
+	}
+	return nil
+}
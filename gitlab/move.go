@@ -0,0 +1,170 @@
+package gitlab
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+// MoveProjects 将匹配的项目批量转移到目标分组，并同步移动本地克隆目录、改写 origin 地址
+func MoveProjects(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: doo gitlab move <src-pattern> <dest-group>")
+	}
+	var (
+		pattern = ctx.Args().Get(0)
+		dest    = ctx.Args().Get(1)
+		rename  = ctx.String("rename")
+		root    = ctx.String("root")
+	)
+	if root == "" {
+		root = os.Getenv("DOO_GITLAB_SYNC_ROOT")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %s: %v", pattern, err)
+	}
+
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+
+	destGroup, err := client.GetGroup(dest)
+	if err != nil {
+		return fmt.Errorf("get group %s failed: %v", dest, err)
+	}
+
+	groups, err := client.GetGroups()
+	if err != nil {
+		return err
+	}
+	var projects []*gitlab.Project
+	// 分组项目列表包含共享给该分组的项目，同一个项目可能匹配多次
+	var seen = make(map[int]struct{})
+	for _, group := range groups {
+		if group.ID == destGroup.ID {
+			continue
+		}
+		ps, err := client.GetGroupProjects(group.ID)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+			continue
+		}
+		for _, p := range ps {
+			if _, ok := seen[p.ID]; ok {
+				continue
+			}
+			if ok, _ := path.Match(pattern, p.PathWithNamespace); ok {
+				seen[p.ID] = struct{}{}
+				projects = append(projects, p)
+			}
+		}
+	}
+	if len(projects) == 0 {
+		fmt.Println("no project matched", pattern)
+		return nil
+	}
+	if rename != "" && len(projects) > 1 {
+		return fmt.Errorf("--rename requires exactly one matched project, got %v", len(projects))
+	}
+
+	for _, p := range projects {
+		var newPath = p.Path
+		if rename != "" {
+			newPath = rename
+		}
+		fmt.Printf("%s -> %s/%s\n", p.PathWithNamespace, destGroup.FullPath, newPath)
+	}
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("transfer %v projects to %s?", len(projects), destGroup.FullPath)) {
+		fmt.Println("canceled")
+		return nil
+	}
+
+	var failed int
+	for _, p := range projects {
+		moved, err := client.TransferProject(p.ID, destGroup.ID)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Transfer project %s failed: %v\n", p.PathWithNamespace, err)
+			failed++
+			continue
+		}
+		fmt.Printf("--- [INFO] Transfer project %s to %s\n", p.PathWithNamespace, moved.PathWithNamespace)
+		// 先按转移后的路径移动本地克隆，重命名失败时本地目录也和远端一致
+		if root != "" {
+			if err = relocateClone(root, p, moved); err != nil {
+				fmt.Printf("--- [ERROR] Relocate local clone of %s failed: %v\n", p.PathWithNamespace, err)
+				failed++
+				continue
+			}
+		}
+
+		if rename == "" {
+			continue
+		}
+		renamed, err := client.RenameProject(p.ID, rename)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Rename project %s failed: %v\n", moved.PathWithNamespace, err)
+			failed++
+			continue
+		}
+		fmt.Printf("--- [INFO] Rename project %s to %s\n", moved.PathWithNamespace, renamed.PathWithNamespace)
+		if root == "" {
+			continue
+		}
+		if err = relocateClone(root, moved, renamed); err != nil {
+			fmt.Printf("--- [ERROR] Relocate local clone of %s failed: %v\n", moved.PathWithNamespace, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("move failed for %v projects", failed)
+	}
+	return nil
+}
+
+// relocateClone 将同步根目录下的本地克隆移动到新位置，并改写 origin 地址
+func relocateClone(root string, from, to *gitlab.Project) error {
+	oldDir := fmt.Sprintf("%s/%s", root, from.PathWithNamespace)
+	if !utils.IsDir(oldDir) {
+		return nil
+	}
+	newDir := fmt.Sprintf("%s/%s", root, to.PathWithNamespace)
+	if utils.IsDir(newDir) {
+		return fmt.Errorf("%s already exists", newDir)
+	}
+	if err := os.MkdirAll(path.Dir(newDir), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return err
+	}
+	fmt.Printf("--- [INFO] Move %s to %s\n", oldDir, newDir)
+
+	repo, err := git.PlainOpen(newDir)
+	if err != nil {
+		return err
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	remote, ok := cfg.Remotes["origin"]
+	if !ok {
+		return nil
+	}
+	var url = to.HTTPURLToRepo
+	if len(remote.URLs) > 0 && !strings.HasPrefix(remote.URLs[0], "http") {
+		url = to.SSHURLToRepo
+	}
+	remote.URLs = []string{url}
+	return repo.SetConfig(cfg)
+}
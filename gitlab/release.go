@@ -0,0 +1,205 @@
+package gitlab
+
+import (
+	"fmt"
+	"regexp"
+	"sasukebo/doo/gitlab/client"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+var conventionalCommitExp = regexp.MustCompile(`^(\w+)(\([^)]*\))?!?:\s*(.+)$`)
+
+var conventionalTypes = []struct {
+	Type  string
+	Title string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance"},
+	{"refactor", "Refactoring"},
+	{"docs", "Documentation"},
+	{"test", "Tests"},
+	{"build", "Build"},
+	{"ci", "CI"},
+	{"chore", "Chores"},
+}
+
+// CreateRelease 从指定 ref 创建标签，根据上一个标签以来合并的合并请求和约定式提交生成变更日志，并创建 gitlab release
+func CreateRelease(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: doo gitlab release <group/project> <tag>")
+	}
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+	var (
+		path = ctx.Args().Get(0)
+		tag  = ctx.Args().Get(1)
+	)
+
+	project, err := client.GetProject(path)
+	if err != nil {
+		return fmt.Errorf("get project %s failed: %v", path, err)
+	}
+	ref := ctx.String("ref")
+	if ref == "" {
+		ref = project.DefaultBranch
+	}
+
+	var (
+		previous = ctx.String("previous")
+		since    *time.Time
+		commits  []*gitlab.Commit
+	)
+	var t *gitlab.Tag
+	if previous == "" {
+		if t, err = client.GetLatestTag(project.ID, tag); err != nil {
+			return err
+		}
+	} else if t, err = client.GetTag(project.ID, previous); err != nil {
+		return fmt.Errorf("get tag %s failed: %v", previous, err)
+	}
+	// 只查询上一个标签之后更新过的合并请求，避免翻页获取所有合并请求
+	if t != nil {
+		previous = t.Name
+		if t.Commit != nil {
+			since = t.Commit.CommittedDate
+		}
+	}
+	if previous != "" {
+		commits, err = client.CompareCommits(project.ID, previous, ref)
+	} else {
+		commits, err = client.GetRefCommits(project.ID, ref)
+	}
+	if err != nil {
+		return err
+	}
+
+	mrs, err := client.GetMergedMergeRequests(project.ID, since)
+	if err != nil {
+		return err
+	}
+
+	notes := generateChangelog(previous, tag, commits, mrs)
+	if ctx.Bool("dry-run") {
+		fmt.Println(notes)
+		return nil
+	}
+
+	if _, err = client.CreateTag(project.ID, tag, ref, "Release "+tag); err != nil {
+		return fmt.Errorf("create tag %s failed: %v", tag, err)
+	}
+	release, err := client.CreateRelease(project.ID, tag, tag, notes)
+	if err != nil {
+		return fmt.Errorf("create release %s failed: %v", tag, err)
+	}
+	fmt.Printf("release %s created for %s\n", release.TagName, project.PathWithNamespace)
+	return nil
+}
+
+// generateChangelog 合并请求按标签分组，未通过合并请求进入的约定式提交按类型分组
+func generateChangelog(previous, tag string, commits []*gitlab.Commit, mrs []*gitlab.MergeRequest) string {
+	var (
+		shas     = make(map[string]struct{})
+		mrTitles = make(map[string]struct{})
+		byLabel  = make(map[string][]*gitlab.MergeRequest)
+		labels   []string
+	)
+	for _, commit := range commits {
+		shas[commit.ID] = struct{}{}
+	}
+	for _, mr := range mrs {
+		if !mrInCommits(mr, shas) {
+			continue
+		}
+		mrTitles[mr.Title] = struct{}{}
+		var label = "Other"
+		if len(mr.Labels) > 0 {
+			ls := append([]string{}, mr.Labels...)
+			sort.Strings(ls)
+			label = ls[0]
+		}
+		if _, ok := byLabel[label]; !ok {
+			labels = append(labels, label)
+		}
+		byLabel[label] = append(byLabel[label], mr)
+	}
+	sort.Strings(labels)
+
+	var b strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&b, "## %s (changes since %s)\n\n", tag, previous)
+	} else {
+		fmt.Fprintf(&b, "## %s\n\n", tag)
+	}
+
+	if len(labels) > 0 {
+		b.WriteString("### Merge Requests\n\n")
+		for _, label := range labels {
+			fmt.Fprintf(&b, "#### %s\n\n", label)
+			for _, mr := range byLabel[label] {
+				var author string
+				if mr.Author != nil {
+					author = " @" + mr.Author.Username
+				}
+				fmt.Fprintf(&b, "- %s !%v%s\n", mr.Title, mr.IID, author)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	var (
+		byType = make(map[string][]string)
+		others []string
+	)
+	for _, commit := range commits {
+		if len(commit.ParentIDs) > 1 || strings.HasPrefix(commit.Title, "Merge branch") {
+			continue
+		}
+		if _, ok := mrTitles[commit.Title]; ok {
+			continue
+		}
+		m := conventionalCommitExp.FindStringSubmatch(commit.Title)
+		if m == nil {
+			others = append(others, fmt.Sprintf("- %s (%s)", commit.Title, commit.ShortID))
+			continue
+		}
+		var scope = strings.Trim(m[2], "()")
+		if scope != "" {
+			scope = "**" + scope + ":** "
+		}
+		byType[strings.ToLower(m[1])] = append(byType[strings.ToLower(m[1])], fmt.Sprintf("- %s%s (%s)", scope, m[3], commit.ShortID))
+	}
+
+	var known = make(map[string]struct{})
+	for _, t := range conventionalTypes {
+		known[t.Type] = struct{}{}
+		if items := byType[t.Type]; len(items) > 0 {
+			fmt.Fprintf(&b, "### %s\n\n%s\n\n", t.Title, strings.Join(items, "\n"))
+		}
+	}
+	for typ, items := range byType {
+		if _, ok := known[typ]; !ok {
+			others = append(others, items...)
+		}
+	}
+	if len(others) > 0 {
+		fmt.Fprintf(&b, "### Other Changes\n\n%s\n", strings.Join(others, "\n"))
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+func mrInCommits(mr *gitlab.MergeRequest, shas map[string]struct{}) bool {
+	for _, sha := range []string{mr.MergeCommitSHA, mr.SquashCommitSHA, mr.SHA} {
+		if _, ok := shas[sha]; ok && sha != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestGenerateChangelog(t *testing.T) {
+	commit := func(id, title string, parents ...string) *gitlab.Commit {
+		return &gitlab.Commit{ID: id, ShortID: id[:3], Title: title, ParentIDs: parents}
+	}
+	cases := []struct {
+		name     string
+		previous string
+		commits  []*gitlab.Commit
+		mrs      []*gitlab.MergeRequest
+		want     string
+	}{
+		{
+			name: "first release",
+			commits: []*gitlab.Commit{
+				commit("aaa111", "feat(api): add users endpoint"),
+				commit("bbb222", "initial import"),
+			},
+			want: "## v1.0.0\n\n" +
+				"### Features\n\n- **api:** add users endpoint (aaa)\n\n" +
+				"### Other Changes\n\n- initial import (bbb)",
+		},
+		{
+			name:     "merge requests and commits since previous tag",
+			previous: "v0.9.0",
+			commits: []*gitlab.Commit{
+				commit("ccc333", "Merge branch 'login' into 'main'", "aaa111", "bbb222"),
+				commit("ddd444", "fix: handle empty password"),
+				commit("eee555", "Add login page"),
+				commit("fff666", "chore: bump deps"),
+				commit("ggg777", "wip: spike sso"),
+			},
+			mrs: []*gitlab.MergeRequest{
+				{IID: 7, Title: "Add login page", MergeCommitSHA: "ccc333", Labels: []string{"frontend", "feature"}, Author: &gitlab.BasicUser{Username: "alice"}},
+				{IID: 8, Title: "Not in this release", MergeCommitSHA: "zzz999"},
+			},
+			want: "## v1.0.0 (changes since v0.9.0)\n\n" +
+				"### Merge Requests\n\n#### feature\n\n- Add login page !7 @alice\n\n" +
+				"### Bug Fixes\n\n- handle empty password (ddd)\n\n" +
+				"### Chores\n\n- bump deps (fff)\n\n" +
+				"### Other Changes\n\n- spike sso (ggg)",
+		},
+	}
+	for _, c := range cases {
+		if got := generateChangelog(c.previous, "v1.0.0", c.commits, c.mrs); got != c.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", c.name, got, c.want)
+		}
+	}
+}
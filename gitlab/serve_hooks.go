@@ -0,0 +1,200 @@
+package gitlab
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"sort"
+	"sync"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+// syncJob 一次同步任务，from 不为空时先把本地克隆从 from 移动到 path 再更新
+type syncJob struct {
+	path string
+	from string
+}
+
+// syncQueue 待同步的项目队列，同一项目在等待期间只会排队一次，同一目录同时只有一个任务在执行
+type syncQueue struct {
+	mu      sync.Mutex
+	pending map[string]*syncJob
+	locks   map[string]*sync.Mutex
+	ch      chan *syncJob
+}
+
+func (q *syncQueue) push(path, from string) bool {
+	q.mu.Lock()
+	if j, ok := q.pending[path]; ok {
+		if from != "" {
+			j.from = from
+		}
+		q.mu.Unlock()
+		return true
+	}
+	j := &syncJob{path: path, from: from}
+	q.pending[path] = j
+	q.mu.Unlock()
+
+	select {
+	case q.ch <- j:
+		return true
+	default:
+		q.mu.Lock()
+		delete(q.pending, path)
+		q.mu.Unlock()
+		return false
+	}
+}
+
+// pop 任务开始执行，之后收到的事件会重新排队，等当前任务结束后再同步一次
+func (q *syncQueue) pop(j *syncJob) (string, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, j.path)
+	return j.path, j.from
+}
+
+// lock 按顺序锁定多个目录，返回解锁函数
+func (q *syncQueue) lock(paths ...string) func() {
+	sort.Strings(paths)
+	var locked []*sync.Mutex
+	for i, path := range paths {
+		if i > 0 && path == paths[i-1] {
+			continue
+		}
+		q.mu.Lock()
+		l, ok := q.locks[path]
+		if !ok {
+			l = &sync.Mutex{}
+			q.locks[path] = l
+		}
+		q.mu.Unlock()
+		l.Lock()
+		locked = append(locked, l)
+	}
+	return func() {
+		for _, l := range locked {
+			l.Unlock()
+		}
+	}
+}
+
+// ServeHooks 启动 webhook 服务，收到 push/tag/project 事件时只更新受影响的本地克隆
+func ServeHooks(ctx *cli.Context) error {
+	accessToken, err := utils.MustGetStringArg(ctx, "access_token", "DOO_GITLAB_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+	if err = client.Init(ctx); err != nil {
+		return err
+	}
+	root, err := utils.MustGetStringArg(ctx, "root", "DOO_GITLAB_SYNC_ROOT")
+	if err != nil {
+		return err
+	}
+	secret, err := utils.MustGetStringArg(ctx, "secret", "DOO_GITLAB_HOOK_SECRET")
+	if err != nil {
+		return err
+	}
+
+	var (
+		auth = gitAuth(accessToken)
+		q    = &syncQueue{pending: make(map[string]*syncJob), locks: make(map[string]*sync.Mutex), ch: make(chan *syncJob, 1024)}
+	)
+	jobs := ctx.Int("jobs")
+	if jobs <= 0 {
+		jobs = 1
+	}
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for j := range q.ch {
+				path, from := q.pop(j)
+				syncProject(q, root, path, from, auth)
+			}
+		}()
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		event, err := gitlab.ParseHook(gitlab.HookEventType(r), payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// 重命名和转移时记录原路径，移动本地克隆也在队列中执行
+		var paths, froms []string
+		switch e := event.(type) {
+		case *gitlab.PushEvent:
+			paths, froms = append(paths, e.Project.PathWithNamespace), append(froms, "")
+		case *gitlab.TagEvent:
+			paths, froms = append(paths, e.Project.PathWithNamespace), append(froms, "")
+		case *gitlab.PushSystemEvent:
+			paths, froms = append(paths, e.Project.PathWithNamespace), append(froms, "")
+		case *gitlab.TagPushSystemEvent:
+			paths, froms = append(paths, e.Project.PathWithNamespace), append(froms, "")
+		case *gitlab.ProjectSystemEvent:
+			switch e.EventName {
+			case "project_create":
+				paths, froms = append(paths, e.PathWithNamespace), append(froms, "")
+			case "project_rename", "project_transfer":
+				paths, froms = append(paths, e.PathWithNamespace), append(froms, e.OldPathWithNamespace)
+			}
+		}
+
+		for i, path := range paths {
+			if !q.push(path, froms[i]) {
+				http.Error(w, "queue is full", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Printf("--- [INFO] Queue %s for %s\n", path, gitlab.HookEventType(r))
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	addr := ctx.String("addr")
+	fmt.Printf("--- [INFO] Listen on %s\n", addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+// syncProject 使用与 gitlab sync 相同的代码克隆或更新单个项目，from 不为空时先移动原路径的本地克隆
+func syncProject(q *syncQueue, root, path, from string, auth *githttp.BasicAuth) {
+	project, err := client.GetProject(path)
+	if err != nil {
+		fmt.Printf("--- [ERROR] Get project %s failed: %v\n", path, err)
+		return
+	}
+	var paths = []string{project.PathWithNamespace}
+	if from != "" {
+		paths = append(paths, from)
+	}
+	unlock := q.lock(paths...)
+	defer unlock()
+
+	if from != "" {
+		if err = relocateClone(root, &gitlab.Project{PathWithNamespace: from}, project); err != nil {
+			fmt.Printf("--- [ERROR] Relocate local clone of %s failed: %v\n", from, err)
+		}
+	}
+	projectDir := fmt.Sprintf("%s/%s", root, project.PathWithNamespace)
+	_ = cloneOrUpdateProject(project, projectDir, auth)
+}
@@ -0,0 +1,158 @@
+package gitlab
+
+import (
+	"fmt"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/xanzy/go-gitlab"
+)
+
+// StaleProjects 列出N天内没有提交、合并请求和流水线的项目，可选批量归档
+func StaleProjects(ctx *cli.Context) error {
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+
+	days := ctx.Int("days")
+	if days <= 0 {
+		return fmt.Errorf("days must be greater than 0")
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	groups, err := selectGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var stales []*gitlab.Project
+	fmt.Printf("%-60s %-10s %-20s\n", "Project", "Size", "Last Activity")
+	for _, group := range groups {
+		projects, err := client.GetGroupProjects(group.ID)
+		if err != nil {
+			fmt.Printf("--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+			continue
+		}
+		for _, project := range projects {
+			if project.Archived {
+				continue
+			}
+			stale, err := isStaleProject(project.ID, since)
+			if err != nil {
+				fmt.Printf("--- [ERROR] Check activity for project %s failed: %v\n", project.PathWithNamespace, err)
+				continue
+			}
+			if !stale {
+				continue
+			}
+			var size int64
+			if p, err := client.GetProject(project.ID); err == nil && p.Statistics != nil {
+				size = p.Statistics.StorageSize
+			}
+			var lastActivity = "-"
+			if project.LastActivityAt != nil {
+				lastActivity = project.LastActivityAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-60s %-10s %-20s\n", project.PathWithNamespace, utils.HumanSize(size), lastActivity)
+			stales = append(stales, project)
+		}
+	}
+	fmt.Printf("\nTotal stale projects: %v\n", len(stales))
+
+	if !ctx.Bool("archive") || len(stales) == 0 {
+		return nil
+	}
+	return archiveProjects(ctx, stales, true)
+}
+
+// UnarchiveProjects 取消归档指定的项目，不指定项目时取消归档所选分组内所有已归档的项目
+func UnarchiveProjects(ctx *cli.Context) error {
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+
+	var projects []*gitlab.Project
+	if ctx.NArg() > 0 {
+		for _, path := range ctx.Args().Slice() {
+			p, err := client.GetProject(path)
+			if err != nil {
+				return fmt.Errorf("get project %s failed: %v", path, err)
+			}
+			projects = append(projects, p)
+		}
+	} else {
+		groups, err := selectGroups(ctx)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			ps, err := client.GetGroupProjects(group.ID)
+			if err != nil {
+				fmt.Printf("--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+				continue
+			}
+			for _, p := range ps {
+				if p.Archived {
+					projects = append(projects, p)
+				}
+			}
+		}
+	}
+
+	if len(projects) == 0 {
+		fmt.Println("no project to unarchive")
+		return nil
+	}
+	return archiveProjects(ctx, projects, false)
+}
+
+func isStaleProject(id int, since time.Time) (bool, error) {
+	for _, active := range []func(int, time.Time) (bool, error){
+		client.HasCommitsSince,
+		client.HasMergeRequestsSince,
+		client.HasPipelinesSince,
+	} {
+		ok, err := active(id, since)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func archiveProjects(ctx *cli.Context, projects []*gitlab.Project, archive bool) error {
+	var action, do = "archive", client.ArchiveProject
+	if !archive {
+		action, do = "unarchive", client.UnarchiveProject
+	}
+
+	if ctx.Bool("dry-run") {
+		for _, p := range projects {
+			fmt.Printf("[DRY-RUN] %s %s\n", action, p.PathWithNamespace)
+		}
+		return nil
+	}
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("%s %v projects?", action, len(projects))) {
+		fmt.Println("canceled")
+		return nil
+	}
+
+	var failed int
+	for _, p := range projects {
+		if err := do(p.ID); err != nil {
+			fmt.Printf("--- [ERROR] %s project %s failed: %v\n", action, p.PathWithNamespace, err)
+			failed++
+			continue
+		}
+		fmt.Printf("--- [INFO] %s project %s\n", action, p.PathWithNamespace)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed for %v projects", action, failed)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"sort"
+
+	"github.com/urfave/cli/v2"
+)
+
+type projectStorage struct {
+	Project              string `json:"project"`
+	Repository           int64  `json:"repository"`
+	LFS                  int64  `json:"lfs"`
+	Artifacts            int64  `json:"artifacts"`
+	Packages             int64  `json:"packages"`
+	Registry             int64  `json:"registry"`
+	Total                int64  `json:"total"`
+	NeverExpireArtifacts int    `json:"never_expire_artifacts"`
+	NeverExpireSize      int64  `json:"never_expire_size"`
+}
+
+type groupStorage struct {
+	Group    string            `json:"group"`
+	Total    int64             `json:"total"`
+	Projects []*projectStorage `json:"projects"`
+}
+
+// StorageSummary 统计各分组、项目的仓库、LFS、产物、包和镜像仓库占用空间，错误输出到 stderr，存在错误时返回非 0
+func StorageSummary(ctx *cli.Context) error {
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+
+	groups, err := selectGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		reports []*groupStorage
+		all     []*projectStorage
+		failed  int
+		pages   = ctx.Int("job-pages")
+	)
+	for _, group := range groups {
+		projects, err := client.GetGroupProjects(group.ID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] Get projects for group %s failed: %v\n", group.FullPath, err)
+			failed++
+			continue
+		}
+		gr := &groupStorage{Group: group.FullPath}
+		for _, project := range projects {
+			stat, err := client.GetProjectStatistics(project.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "--- [ERROR] Get statistics for project %s failed: %v\n", project.PathWithNamespace, err)
+				failed++
+				continue
+			}
+			ps := &projectStorage{
+				Project:    project.PathWithNamespace,
+				Repository: stat.RepositorySize,
+				LFS:        stat.LFSObjectsSize,
+				Artifacts:  stat.JobArtifactsSize + stat.PipelineArtifactsSize,
+				Packages:   stat.PackagesSize,
+				Registry:   stat.ContainerRegistrySize,
+			}
+			ps.Total = ps.Repository + ps.LFS + ps.Artifacts + ps.Packages + ps.Registry
+			if ps.Artifacts > 0 {
+				ps.NeverExpireArtifacts, ps.NeverExpireSize, err = client.GetNeverExpireArtifacts(project.ID, pages)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "--- [ERROR] Get jobs for project %s failed: %v\n", project.PathWithNamespace, err)
+					failed++
+				}
+			}
+			gr.Projects = append(gr.Projects, ps)
+			gr.Total += ps.Total
+			all = append(all, ps)
+		}
+		sort.Slice(gr.Projects, func(i, j int) bool { return gr.Projects[i].Total > gr.Projects[j].Total })
+		reports = append(reports, gr)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Total > reports[j].Total })
+
+	if format == "json" {
+		content, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return storageFailed(failed)
+	}
+
+	var total int64
+	for _, gr := range reports {
+		fmt.Printf("*** Gitlab 项目组： %s  总计: %s ***\n", gr.Group, utils.HumanSize(gr.Total))
+		fmt.Printf("  %-50s %-10s %-10s %-10s %-10s %-10s %-10s\n", "Project", "Repo", "LFS", "Artifacts", "Packages", "Registry", "Total")
+		for _, ps := range gr.Projects {
+			fmt.Printf(
+				"  %-50s %-10s %-10s %-10s %-10s %-10s %-10s\n",
+				ps.Project, utils.HumanSize(ps.Repository), utils.HumanSize(ps.LFS), utils.HumanSize(ps.Artifacts),
+				utils.HumanSize(ps.Packages), utils.HumanSize(ps.Registry), utils.HumanSize(ps.Total),
+			)
+		}
+		fmt.Println()
+		total += gr.Total
+	}
+	fmt.Printf("最终统计： %s\n\n", utils.HumanSize(total))
+
+	top := ctx.Int("top")
+	sort.Slice(all, func(i, j int) bool { return all[i].Total > all[j].Total })
+	fmt.Printf("*** 占用最大的 %v 个项目 ***\n", top)
+	for i, ps := range all {
+		if i >= top {
+			break
+		}
+		fmt.Printf("  %-50s %-10s\n", ps.Project, utils.HumanSize(ps.Total))
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].NeverExpireSize > all[j].NeverExpireSize })
+	var sampled = "所有任务"
+	if pages > 0 {
+		sampled = fmt.Sprintf("最近 %v 个任务", pages*100)
+	}
+	fmt.Printf("\n*** 永不过期的任务产物（%s） ***\n", sampled)
+	for i, ps := range all {
+		if i >= top || ps.NeverExpireArtifacts == 0 {
+			break
+		}
+		fmt.Printf(
+			"  %-50s %v 个任务产物未设置过期时间，共 %s，产物总计 %s\n",
+			ps.Project, ps.NeverExpireArtifacts, utils.HumanSize(ps.NeverExpireSize), utils.HumanSize(ps.Artifacts),
+		)
+	}
+	return storageFailed(failed)
+}
+
+func storageFailed(failed int) error {
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "--- [ERROR] %v requests failed, the report is incomplete\n", failed)
+		return cli.Exit("", 1)
+	}
+	return nil
+}
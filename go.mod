@@ -6,6 +6,7 @@ require (
 	github.com/go-git/go-git/v5 v5.4.2
 	github.com/urfave/cli/v2 v2.23.0
 	github.com/xanzy/go-gitlab v0.74.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
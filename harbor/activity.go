@@ -0,0 +1,290 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// auditLog harbor 审计日志，resource 为 project/repo:tag 或 project/repo@digest
+type auditLog struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	Resource     string `json:"resource"`
+	ResourceType string `json:"resource_type"`
+	Operation    string `json:"operation"`
+	OpTime       string `json:"op_time"`
+}
+
+type activityCount struct {
+	Name    string `json:"name"`
+	Pulls   int    `json:"pulls"`
+	Pushes  int    `json:"pushes"`
+	Deletes int    `json:"deletes"`
+	Last    string `json:"last"`
+}
+
+func (a *activityCount) total() int {
+	return a.Pulls + a.Pushes + a.Deletes
+}
+
+type notPulledArtifact struct {
+	Image    string `json:"image"`
+	Tags     string `json:"tags"`
+	Size     int64  `json:"size"`
+	PushTime string `json:"push_time"`
+	PullTime string `json:"pull_time"`
+}
+
+type activityReport struct {
+	Since          string               `json:"since"`
+	Until          string               `json:"until"`
+	Repositories   []*activityCount     `json:"repositories"`
+	Users          []*activityCount     `json:"users"`
+	Days           []*activityCount     `json:"days"`
+	NotPulledDays  int                  `json:"not_pulled_days,omitempty"`
+	NotPulled      []*notPulledArtifact `json:"not_pulled,omitempty"`
+	NotPulledTotal int64                `json:"not_pulled_size,omitempty"`
+}
+
+// Activity 统计时间范围内的审计日志，按仓库、用户和日期汇总拉取、推送和删除次数，
+// --not-pulled 时列出 N 天内没有被拉取过的镜像，作为 clean_artifacts 中 not_pulled_days 的参考
+func Activity(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	until := time.Now()
+	if v := ctx.String("until"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid until %s, should be like 2006-01-02", v)
+		}
+		until = t.Add(24*time.Hour - time.Second)
+	}
+	since := until.AddDate(0, 0, -30)
+	if v := ctx.String("since"); v != "" {
+		if since, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return fmt.Errorf("invalid since %s, should be like 2006-01-02", v)
+		}
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("since should be before until")
+	}
+	var projects []string
+	if p := ctx.String("project"); p != "" {
+		projects = strings.Split(p, ",")
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	logs, err := getAuditLogs(sigCtx, c, projects, since, until)
+	if err != nil {
+		return err
+	}
+	report := aggregateActivity(logs)
+	report.Since, report.Until = since.Format("2006-01-02 15:04:05"), until.Format("2006-01-02 15:04:05")
+
+	if days := ctx.Int("not-pulled"); days > 0 {
+		if len(projects) == 0 {
+			all, err := getProjects(sigCtx, c, "")
+			if err != nil {
+				return err
+			}
+			for _, p := range all {
+				projects = append(projects, p.Name)
+			}
+		}
+		report.NotPulledDays = days
+		now := time.Now()
+		for _, project := range projects {
+			repositories, err := getRepositoryNames(sigCtx, c, project)
+			if err != nil {
+				return err
+			}
+			for _, repo := range repositories {
+				if sigCtx.Err() != nil {
+					return sigCtx.Err()
+				}
+				artifacts, err := getTotalArtifacts(sigCtx, c, project, repo)
+				if err != nil {
+					return err
+				}
+				for _, a := range artifacts {
+					// 和保留策略的 not_pulled_days 一致，从未拉取过的按推送时间计算
+					last := parseHarborTime(a.PullTime)
+					if last.IsZero() {
+						last = parseHarborTime(a.PushTime)
+					}
+					if !olderThan(last, now, days) {
+						continue
+					}
+					report.NotPulled = append(report.NotPulled, &notPulledArtifact{
+						Image:    project + "/" + repo + "@" + a.Digest,
+						Tags:     a.tagNames(),
+						Size:     a.Size,
+						PushTime: a.PushTime,
+						PullTime: a.PullTime,
+					})
+					report.NotPulledTotal += a.Size
+				}
+			}
+		}
+		sort.Slice(report.NotPulled, func(i, j int) bool { return report.NotPulled[i].Size > report.NotPulled[j].Size })
+	}
+
+	if format == "json" {
+		content, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+
+	fmt.Printf("%v audit logs from %s to %s\n", len(logs), report.Since, report.Until)
+	top := ctx.Int("top")
+	for _, section := range []struct {
+		title  string
+		column string
+		counts []*activityCount
+		limit  int
+	}{
+		{"repositories", "Repository", report.Repositories, top},
+		{"users", "User", report.Users, top},
+		{"days", "Day", report.Days, 0},
+	} {
+		fmt.Printf("\n*** %s ***\n", section.title)
+		fmt.Printf("  %-50s %-8s %-8s %-8s %s\n", section.column, "Pulls", "Pushes", "Deletes", "Last")
+		for i, a := range section.counts {
+			if section.limit > 0 && i >= section.limit {
+				fmt.Printf("  ... %v more\n", len(section.counts)-i)
+				break
+			}
+			fmt.Printf("  %-50s %-8v %-8v %-8v %s\n", a.Name, a.Pulls, a.Pushes, a.Deletes, formatHarborTime(a.Last))
+		}
+	}
+
+	if report.NotPulledDays > 0 {
+		fmt.Printf("\n*** not pulled in %v days ***\n", report.NotPulledDays)
+		fmt.Printf("  %-90s %-30s %-20s %-20s %s\n", "Image", "Tags", "Pushed", "Pulled", "Size")
+		for _, a := range report.NotPulled {
+			fmt.Printf(
+				"  %-90s %-30s %-20s %-20s %s\n",
+				a.Image, a.Tags, formatHarborTime(a.PushTime), formatHarborTime(a.PullTime), utils.HumanSize(a.Size),
+			)
+		}
+		fmt.Printf(
+			"%v artifacts, %s in total, set not_pulled_days: %v in the clean_artifacts rules to delete them\n",
+			len(report.NotPulled), utils.HumanSize(report.NotPulledTotal), report.NotPulledDays,
+		)
+	}
+	return nil
+}
+
+// aggregateActivity 按仓库、用户和日期汇总，仓库和用户按操作次数倒序，日期按时间顺序
+func aggregateActivity(logs []*auditLog) *activityReport {
+	var repos, users, days = map[string]*activityCount{}, map[string]*activityCount{}, map[string]*activityCount{}
+	count := func(m map[string]*activityCount, key string, l *auditLog) {
+		a, ok := m[key]
+		if !ok {
+			a = &activityCount{Name: key}
+			m[key] = a
+		}
+		switch strings.ToLower(l.Operation) {
+		case "pull":
+			a.Pulls++
+		case "create", "push":
+			a.Pushes++
+		case "delete":
+			a.Deletes++
+		default:
+			return
+		}
+		if parseHarborTime(l.OpTime).After(parseHarborTime(a.Last)) {
+			a.Last = l.OpTime
+		}
+	}
+	for _, l := range logs {
+		repo := l.Resource
+		if ref, err := parseImageRef(l.Resource, false); err == nil {
+			repo = ref.name()
+		}
+		count(repos, repo, l)
+		count(users, l.Username, l)
+		if t := parseHarborTime(l.OpTime); !t.IsZero() {
+			count(days, t.Local().Format("2006-01-02"), l)
+		}
+	}
+
+	sorted := func(m map[string]*activityCount, byTotal bool) []*activityCount {
+		var outs []*activityCount
+		for _, a := range m {
+			if a.total() > 0 {
+				outs = append(outs, a)
+			}
+		}
+		sort.Slice(outs, func(i, j int) bool {
+			if byTotal && outs[i].total() != outs[j].total() {
+				return outs[i].total() > outs[j].total()
+			}
+			return outs[i].Name < outs[j].Name
+		})
+		return outs
+	}
+	return &activityReport{
+		Repositories: sorted(repos, true),
+		Users:        sorted(users, true),
+		Days:         sorted(days, false),
+	}
+}
+
+// getAuditLogs 分页获取时间范围内的审计日志，指定项目时只保留这些项目下的资源
+func getAuditLogs(ctx context.Context, c *Client, projects []string, since, until time.Time) ([]*auditLog, error) {
+	query := fmt.Sprintf(
+		"op_time=[\"%s\"~\"%s\"]",
+		since.UTC().Format("2006-01-02 15:04:05"), until.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if len(projects) == 1 {
+		query += ",resource=~" + projects[0] + "/"
+	}
+
+	var outs []*auditLog
+	var page, limit = 1, 100
+	for {
+		var _outs []*auditLog
+		uri := fmt.Sprintf("%s/audit-logs?page=%v&page_size=%v&q=%s", c.api, page, limit, url.QueryEscape(query))
+		if err := c.getJSON(ctx, uri, &_outs); err != nil {
+			return nil, err
+		}
+		for _, l := range _outs {
+			if len(projects) == 0 {
+				outs = append(outs, l)
+				continue
+			}
+			for _, p := range projects {
+				if strings.HasPrefix(l.Resource, p+"/") {
+					outs = append(outs, l)
+					break
+				}
+			}
+		}
+		if len(_outs) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	return outs, nil
+}
@@ -0,0 +1,367 @@
+package harbor
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Registry 一个Harbor实例的访问配置，使用用户名密码或机器人账号进行 basic auth 认证，
+// 密码可以直接配置，也可以从文件或环境变量读取，都没有配置时读取 ~/.docker/config.json 中的登录信息
+type Registry struct {
+	URL          string `json:"url"`
+	CAFile       string `json:"ca_file"`
+	Insecure     bool   `json:"insecure"`
+	Username     string `json:"username"`
+	Robot        string `json:"robot"`
+	Password     string `json:"password"`
+	PasswordFile string `json:"password_file"`
+	PasswordEnv  string `json:"password_env"`
+
+	// 已废弃，仅用于提示旧的配置文件
+	Cookie string `json:"cookie"`
+	Token  string `json:"token"`
+}
+
+// Config 配置文件，顶层字段为默认实例，也可以在 registries 中配置多个命名实例，通过 --registry 选择
+type Config struct {
+	Registry
+	Default    string               `json:"default"`
+	Registries map[string]*Registry `json:"registries"`
+}
+
+// getConfig 读取配置文件并选择实例，name 为空时使用 --registry 选择的实例，此时环境变量 DOO_HARBOR_* 会覆盖配置文件中的值
+func getConfig(ctx *cli.Context, name string) (*Registry, error) {
+	var config Config
+	configFilePath := ctx.String("config")
+	if configFilePath == "" {
+		configFilePath = os.Getenv("DOO_HARBOR_CONFIG")
+	}
+	if configFilePath != "" {
+		content, err := os.ReadFile(configFilePath)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("parse config %s failed: %v", configFilePath, err)
+		}
+	}
+
+	var (
+		registry = &config.Registry
+		primary  = name == ""
+	)
+	if primary {
+		name = ctx.String("registry")
+	}
+	if primary && name == "" {
+		name = os.Getenv("DOO_HARBOR_REGISTRY")
+	}
+	if primary && name == "" {
+		name = config.Default
+	}
+	if name != "" {
+		r, ok := config.Registries[name]
+		if !ok {
+			return nil, fmt.Errorf("registry %s not found in config", name)
+		}
+		registry = r
+	}
+
+	for env, field := range map[string]*string{
+		"DOO_HARBOR_URL":      &registry.URL,
+		"DOO_HARBOR_CA_FILE":  &registry.CAFile,
+		"DOO_HARBOR_USERNAME": &registry.Username,
+		"DOO_HARBOR_ROBOT":    &registry.Robot,
+		"DOO_HARBOR_PASSWORD": &registry.Password,
+	} {
+		if v := os.Getenv(env); v != "" && primary {
+			*field = v
+		}
+	}
+	if v := os.Getenv("DOO_HARBOR_INSECURE"); v != "" && primary {
+		registry.Insecure, _ = strconv.ParseBool(v)
+	}
+
+	if err := registry.validate(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// validate 检查配置并解析出最终使用的用户名和密码
+func (r *Registry) validate() error {
+	if r.URL == "" {
+		return fmt.Errorf("harbor url is required, set url in config or env DOO_HARBOR_URL")
+	}
+	if r.Cookie != "" || r.Token != "" {
+		return fmt.Errorf("cookie and token are no longer supported, use username/password or robot account instead")
+	}
+	if r.Username != "" && r.Robot != "" {
+		return fmt.Errorf("username and robot can not be used together")
+	}
+	if r.Robot != "" {
+		r.Username = r.Robot
+		if !strings.HasPrefix(r.Username, "robot$") {
+			r.Username = "robot$" + r.Username
+		}
+	}
+
+	switch {
+	case r.Password != "":
+	case r.PasswordFile != "":
+		content, err := os.ReadFile(r.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("read password file failed: %v", err)
+		}
+		r.Password = strings.TrimSpace(string(content))
+	case r.PasswordEnv != "":
+		r.Password = os.Getenv(r.PasswordEnv)
+		if r.Password == "" {
+			return fmt.Errorf("env %s is empty", r.PasswordEnv)
+		}
+	case r.Username == "":
+		username, password, err := dockerCredentials(r.URL)
+		if err != nil {
+			return err
+		}
+		r.Username, r.Password = username, password
+	}
+
+	if r.Username == "" {
+		return fmt.Errorf("harbor username or robot is required")
+	}
+	if r.Password == "" {
+		return fmt.Errorf("password of %s is required, set password, password_file or password_env in config, or env DOO_HARBOR_PASSWORD", r.Username)
+	}
+	return nil
+}
+
+// dockerCredentials 从 docker login 保存的 ~/.docker/config.json 中读取对应实例的用户名和密码，
+// 配置了 credHelpers 或 credsStore 时调用 docker-credential-<helper> 获取
+func dockerCredentials(registryURL string) (string, string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", nil
+	}
+	content, err := os.ReadFile(filepath.Join(home, ".docker", "config.json"))
+	if err != nil {
+		return "", "", nil
+	}
+	var config struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err = json.Unmarshal(content, &config); err != nil {
+		return "", "", fmt.Errorf("parse docker config failed: %v", err)
+	}
+
+	host := registryURL
+	if u, err := url.Parse(registryURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if helper := config.CredHelpers[host]; helper != "" {
+		return dockerCredentialHelper(helper, host)
+	}
+	for key, a := range config.Auths {
+		if key != host && !strings.HasSuffix(key, "://"+host) && !strings.Contains(key, "://"+host+"/") {
+			continue
+		}
+		if a.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("decode docker auth of %s failed: %v", key, err)
+		}
+		pieces := strings.SplitN(string(decoded), ":", 2)
+		if len(pieces) == 2 {
+			return pieces[0], pieces[1], nil
+		}
+	}
+	if config.CredsStore != "" {
+		return dockerCredentialHelper(config.CredsStore, host)
+	}
+	return "", "", nil
+}
+
+// dockerCredentialHelper 执行 docker-credential-<helper> get 读取凭据
+func dockerCredentialHelper(helper, host string) (string, string, error) {
+	var (
+		name    = "docker-credential-" + helper
+		out     struct{ Username, Secret string }
+		lastErr error
+	)
+	for _, server := range []string{host, "https://" + host} {
+		cmd := exec.Command(name, "get")
+		cmd.Stdin = strings.NewReader(server)
+		content, err := cmd.Output()
+		if err != nil {
+			lastErr = err
+			if e, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(content)) > 0 {
+				lastErr = fmt.Errorf("%v: %s", e, bytes.TrimSpace(content))
+			}
+			continue
+		}
+		if err = json.Unmarshal(content, &out); err != nil {
+			return "", "", fmt.Errorf("parse output of %s failed: %v", name, err)
+		}
+		return out.Username, out.Secret, nil
+	}
+	return "", "", fmt.Errorf(
+		"get credentials of %s from docker credential helper %s failed: %v, "+
+			"set username and password in config, or env DOO_HARBOR_USERNAME and DOO_HARBOR_PASSWORD",
+		host, helper, lastErr,
+	)
+}
+
+// Client Harbor api v2.0 客户端
+type Client struct {
+	*Registry
+	api  string
+	http *http.Client
+}
+
+func newClient(ctx *cli.Context) (*Client, error) {
+	return newRegistryClient(ctx, "")
+}
+
+// newRegistryClient 创建配置文件中指定名称实例的客户端，name 为空时使用 --registry 选择的实例
+func newRegistryClient(ctx *cli.Context, name string) (*Client, error) {
+	registry, err := getConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	api := strings.TrimSuffix(registry.URL, "/")
+	if !strings.Contains(api, "://") {
+		api = "https://" + api
+	}
+	if !strings.HasSuffix(api, "/api/v2.0") {
+		api += "/api/v2.0"
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: registry.Insecure}
+	if registry.CAFile != "" {
+		ca, err := os.ReadFile(registry.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file failed: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", registry.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		Registry: registry,
+		api:      api,
+		http:     &http.Client{Transport: transport},
+	}, nil
+}
+
+func (c *Client) setHeader(req *http.Request) {
+	req.SetBasicAuth(c.Username, c.Password)
+	req.Header.Set("Accept", "application/json")
+}
+
+const maxRetries = 4
+
+// do 发送请求并读取响应，body 不为空时编码为 json。GET、HEAD 和 DELETE 请求遇到 5xx 或 429 时按指数退避重试，
+// 优先使用 Retry-After 指定的等待时间；其他请求服务端可能已经执行，重试会重复创建，因此不重试
+func (c *Client) do(ctx context.Context, method, uri string, body interface{}) (int, []byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return 0, nil, err
+		}
+	}
+	var backoff = time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(data))
+		if err != nil {
+			return 0, nil, err
+		}
+		c.setHeader(req)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		rsp, err := c.http.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		content, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		retry := rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500
+		if !retry || !idempotent(method) || attempt >= maxRetries {
+			return rsp.StatusCode, content, nil
+		}
+
+		wait := backoff
+		if s, err := strconv.Atoi(rsp.Header.Get("Retry-After")); err == nil && s > 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func idempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete
+}
+
+// harborError 从 harbor 的错误响应中取出错误信息
+func harborError(status int, content []byte) error {
+	var rsp struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(content, &rsp) == nil && len(rsp.Errors) > 0 {
+		return fmt.Errorf("%v %s: %s", status, rsp.Errors[0].Code, rsp.Errors[0].Message)
+	}
+	return fmt.Errorf("%v %s", status, string(content))
+}
+
+// getJSON 请求 api 并将响应解析到 out 中
+func (c *Client) getJSON(ctx context.Context, uri string, out interface{}) error {
+	status, content, err := c.do(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return harborError(status, content)
+	}
+	return json.Unmarshal(content, out)
+}
@@ -0,0 +1,105 @@
+package harbor
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// imageRef 镜像引用，reference 为标签或 digest
+type imageRef struct {
+	project   string
+	repo      string
+	reference string
+}
+
+func (r *imageRef) name() string {
+	return r.project + "/" + r.repo
+}
+
+func (r *imageRef) String() string {
+	if strings.HasPrefix(r.reference, "sha256:") {
+		return r.name() + "@" + r.reference
+	}
+	return r.name() + ":" + r.reference
+}
+
+// parseImageRef 解析 project/repo:tag 或 project/repo@sha256:...，仓库名称可以包含多级路径
+func parseImageRef(s string, requireReference bool) (*imageRef, error) {
+	var ref = &imageRef{}
+	name := s
+	if i := strings.Index(s, "@"); i >= 0 {
+		name, ref.reference = s[:i], s[i+1:]
+	} else if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "/") {
+		name, ref.reference = s[:i], s[i+1:]
+	}
+	pieces := strings.SplitN(name, "/", 2)
+	if len(pieces) != 2 || pieces[0] == "" || pieces[1] == "" {
+		return nil, fmt.Errorf("invalid image %s, should be project/repository", s)
+	}
+	ref.project, ref.repo = pieces[0], pieces[1]
+	if requireReference && ref.reference == "" {
+		return nil, fmt.Errorf("tag or digest of %s is required", s)
+	}
+	return ref, nil
+}
+
+// Copy 复制镜像到另一个项目，同一个实例内使用 harbor 的复制接口，跨实例时通过 OCI distribution api 复制清单和 blob
+func Copy(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: copy <src-project/repo:tag> <dst-project/repo>")
+	}
+	src, err := parseImageRef(ctx.Args().Get(0), true)
+	if err != nil {
+		return err
+	}
+	dst, err := parseImageRef(ctx.Args().Get(1), false)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	to := ctx.String("to-registry")
+	if to == "" {
+		if dst.reference != "" {
+			return fmt.Errorf("copy within a registry keeps the source tags, use harbor retag to rename tags")
+		}
+		uri := fmt.Sprintf(
+			"%s/projects/%s/repositories/%s/artifacts?from=%s",
+			c.api, dst.project, escapeRepository(dst.repo), url.QueryEscape(src.String()),
+		)
+		status, content, err := c.do(sigCtx, http.MethodPost, uri, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusCreated {
+			return fmt.Errorf("copy %s to %s failed: %v", src, dst.name(), harborError(status, content))
+		}
+		fmt.Printf("copied %s to %s\n", src, dst.name())
+		return nil
+	}
+
+	target, err := newRegistryClient(ctx, to)
+	if err != nil {
+		return err
+	}
+	if dst.reference == "" {
+		dst.reference = src.reference
+	}
+	srcRegistry, dstRegistry := newRegistryClientFrom(c), newRegistryClientFrom(target)
+	digest, err := srcRegistry.copyManifest(sigCtx, dstRegistry, src.name(), dst.name(), src.reference, dst.reference)
+	if err != nil {
+		return fmt.Errorf("copy %s to %s failed: %v", src, to, err)
+	}
+	fmt.Printf("copied %s to %s %s, digest %s\n", src, to, dst, digest)
+	return nil
+}
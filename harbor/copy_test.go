@@ -0,0 +1,40 @@
+package harbor
+
+import (
+	"testing"
+)
+
+func TestParseImageRef(t *testing.T) {
+	cases := []struct {
+		s                        string
+		requireReference         bool
+		project, repo, reference string
+		err                      bool
+	}{
+		{"lib/app:v1", true, "lib", "app", "v1", false},
+		{"lib/team/api:latest", true, "lib", "team/api", "latest", false},
+		{"lib/app@sha256:abc", true, "lib", "app", "sha256:abc", false},
+		{"lib/team/api@sha256:abc", true, "lib", "team/api", "sha256:abc", false},
+		{"lib/team/api", false, "lib", "team/api", "", false},
+		{"lib/app", true, "", "", "", true},
+		{"app:v1", true, "", "", "", true},
+		{"/app:v1", true, "", "", "", true},
+		{"lib/:v1", true, "", "", "", true},
+	}
+	for _, c := range cases {
+		ref, err := parseImageRef(c.s, c.requireReference)
+		if c.err {
+			if err == nil {
+				t.Errorf("parseImageRef(%q) = %+v, want error", c.s, ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseImageRef(%q) failed: %v", c.s, err)
+			continue
+		}
+		if ref.project != c.project || ref.repo != c.repo || ref.reference != c.reference {
+			t.Errorf("parseImageRef(%q) = %+v, want %s %s %s", c.s, ref, c.project, c.repo, c.reference)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package harbor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	mediaTypeOCIIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest     = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList      = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest  = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerForeign   = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+	mediaTypeOCINonDistLayer = "application/vnd.oci.image.layer.nondistributable"
+)
+
+var manifestAccept = strings.Join([]string{mediaTypeOCIIndex, mediaTypeOCIManifest, mediaTypeDockerList, mediaTypeDockerManifest}, ", ")
+
+// manifest 同时兼容镜像清单和多架构的镜像索引
+type manifest struct {
+	MediaType string        `json:"mediaType"`
+	Config    *descriptor   `json:"config"`
+	Layers    []*descriptor `json:"layers"`
+	Manifests []*descriptor `json:"manifests"`
+}
+
+type descriptor struct {
+	MediaType string   `json:"mediaType"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	URLs      []string `json:"urls"`
+}
+
+func (m *manifest) isIndex() bool {
+	return m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList || (m.Config == nil && len(m.Manifests) > 0)
+}
+
+// registryClient OCI distribution api 客户端，使用 harbor 的账号获取 bearer token
+type registryClient struct {
+	base     string
+	username string
+	password string
+	http     *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func newRegistryClientFrom(c *Client) *registryClient {
+	return &registryClient{
+		base:     strings.TrimSuffix(c.api, "/api/v2.0"),
+		username: c.Username,
+		password: c.Password,
+		http:     c.http,
+		tokens:   make(map[string]string),
+	}
+}
+
+var challengeParamExp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// do 发送请求，收到 401 时按 WWW-Authenticate 获取对应 scope 的 token 后重试
+func (r *registryClient) do(ctx context.Context, method, uri, scope string, header http.Header, body func() (io.Reader, error)) (*http.Response, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			var err error
+			if reader, err = body(); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, r.base+uri, reader)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		// 流式上传时需要指定长度，避免使用 chunked 编码
+		if l := header.Get("Content-Length"); l != "" {
+			req.ContentLength, _ = strconv.ParseInt(l, 10, 64)
+		}
+		r.mu.Lock()
+		token := r.tokens[scope]
+		r.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.SetBasicAuth(r.username, r.password)
+		}
+		rsp, err := r.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if rsp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return rsp, nil
+		}
+		challenge := rsp.Header.Get("WWW-Authenticate")
+		rsp.Body.Close()
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, fmt.Errorf("%s %s unauthorized", method, uri)
+		}
+		if err = r.fetchToken(ctx, challenge, scope); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s %s unauthorized", method, uri)
+}
+
+func (r *registryClient) fetchToken(ctx context.Context, challenge, scope string) error {
+	var params = make(map[string]string)
+	for _, m := range challengeParamExp.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return fmt.Errorf("invalid auth challenge %s", challenge)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.username, r.password)
+	rsp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	content, _ := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get token for %s failed: %v %s", scope, rsp.StatusCode, string(content))
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(content, &token); err != nil {
+		return err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	r.mu.Lock()
+	r.tokens[scope] = token.Token
+	r.mu.Unlock()
+	return nil
+}
+
+func pullScope(name string) string { return "repository:" + name + ":pull" }
+func pushScope(name string) string { return "repository:" + name + ":pull,push" }
+
+// getManifest 获取清单并校验 digest
+func (r *registryClient) getManifest(ctx context.Context, name, reference string) ([]byte, string, string, error) {
+	header := http.Header{"Accept": []string{manifestAccept}}
+	rsp, err := r.do(ctx, http.MethodGet, fmt.Sprintf("/v2/%s/manifests/%s", name, reference), pullScope(name), header, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer rsp.Body.Close()
+	content, _ := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("get manifest %s:%s failed: %v %s", name, reference, rsp.StatusCode, string(content))
+	}
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		return nil, "", "", fmt.Errorf("manifest digest mismatch, expected %s, got %s", reference, digest)
+	}
+	if d := rsp.Header.Get("Docker-Content-Digest"); d != "" && d != digest {
+		return nil, "", "", fmt.Errorf("manifest digest mismatch, registry returned %s, got %s", d, digest)
+	}
+	mediaType := rsp.Header.Get("Content-Type")
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return content, mediaType, digest, nil
+}
+
+func (r *registryClient) putManifest(ctx context.Context, name, reference, mediaType string, content []byte) error {
+	header := http.Header{"Content-Type": []string{mediaType}}
+	rsp, err := r.do(ctx, http.MethodPut, fmt.Sprintf("/v2/%s/manifests/%s", name, reference), pushScope(name), header,
+		func() (io.Reader, error) { return bytes.NewReader(content), nil })
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return fmt.Errorf("put manifest %s:%s failed: %v %s", name, reference, rsp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (r *registryClient) hasBlob(ctx context.Context, name, digest string) (bool, error) {
+	rsp, err := r.do(ctx, http.MethodHead, fmt.Sprintf("/v2/%s/blobs/%s", name, digest), pushScope(name), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	rsp.Body.Close()
+	return rsp.StatusCode == http.StatusOK, nil
+}
+
+// copyBlob 从源仓库流式读取 blob 并单次上传到目标仓库，上传完成后校验 digest
+func (r *registryClient) copyBlob(ctx context.Context, dst *registryClient, srcName, dstName string, desc *descriptor) error {
+	if ok, err := dst.hasBlob(ctx, dstName, desc.Digest); err != nil || ok {
+		return err
+	}
+	if !strings.HasPrefix(desc.Digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %s", desc.Digest)
+	}
+
+	up, err := dst.do(ctx, http.MethodPost, fmt.Sprintf("/v2/%s/blobs/uploads/", dstName), pushScope(dstName), nil, nil)
+	if err != nil {
+		return err
+	}
+	up.Body.Close()
+	if up.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("start upload of %s failed: %v", desc.Digest, up.StatusCode)
+	}
+	location, err := up.Request.URL.Parse(up.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+
+	// 上传地址可能是绝对地址，只保留路径和参数以复用认证逻辑
+	uri := location.RequestURI()
+	hasher := sha256.New()
+	header := http.Header{
+		"Content-Type":   []string{"application/octet-stream"},
+		"Content-Length": []string{strconv.FormatInt(desc.Size, 10)},
+	}
+	// 认证后重试时已经读过的流不能再用，每次都重新获取源 blob 并重新计算摘要
+	var src io.ReadCloser
+	defer func() {
+		if src != nil {
+			src.Close()
+		}
+	}()
+	put, err := dst.do(ctx, http.MethodPut, uri, pushScope(dstName), header, func() (io.Reader, error) {
+		if src != nil {
+			src.Close()
+		}
+		rsp, err := r.do(ctx, http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", srcName, desc.Digest), pullScope(srcName), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		src = rsp.Body
+		if rsp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(rsp.Body)
+			return nil, fmt.Errorf("get blob %s failed: %v %s", desc.Digest, rsp.StatusCode, string(body))
+		}
+		hasher.Reset()
+		return io.TeeReader(rsp.Body, hasher), nil
+	})
+	if err != nil {
+		return err
+	}
+	defer put.Body.Close()
+	if put.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(put.Body)
+		return fmt.Errorf("upload blob %s failed: %v %s", desc.Digest, put.StatusCode, string(body))
+	}
+	if got := fmt.Sprintf("sha256:%x", hasher.Sum(nil)); got != desc.Digest {
+		return fmt.Errorf("blob digest mismatch, expected %s, got %s", desc.Digest, got)
+	}
+	return nil
+}
+
+// copyManifest 复制清单及其引用的所有 blob，镜像索引会先复制每个子清单
+func (r *registryClient) copyManifest(ctx context.Context, dst *registryClient, srcName, dstName, reference, dstReference string) (string, error) {
+	content, mediaType, digest, err := r.getManifest(ctx, srcName, reference)
+	if err != nil {
+		return "", err
+	}
+	var m manifest
+	if err = json.Unmarshal(content, &m); err != nil {
+		return "", fmt.Errorf("parse manifest %s failed: %v", digest, err)
+	}
+	if mediaType == "" || mediaType == "application/json" {
+		mediaType = m.MediaType
+	}
+
+	if m.isIndex() {
+		for _, child := range m.Manifests {
+			fmt.Printf("[INFO] copy %s manifest %s\n", srcName, child.Digest)
+			if _, err := r.copyManifest(ctx, dst, srcName, dstName, child.Digest, child.Digest); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		var blobs []*descriptor
+		if m.Config != nil {
+			blobs = append(blobs, m.Config)
+		}
+		blobs = append(blobs, m.Layers...)
+		for _, b := range blobs {
+			// 外部层不能分发，由客户端从 urls 下载
+			if len(b.URLs) > 0 || b.MediaType == mediaTypeDockerForeign || strings.HasPrefix(b.MediaType, mediaTypeOCINonDistLayer) {
+				continue
+			}
+			if err := r.copyBlob(ctx, dst, srcName, dstName, b); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if dstReference == "" {
+		dstReference = digest
+	}
+	if err = dst.putManifest(ctx, dstName, dstReference, mediaType, content); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
@@ -0,0 +1,70 @@
+package harbor
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCopyBlobRetry 目标仓库第一次上传返回 401 时，重试要重新读取源 blob
+func TestCopyBlobRetry(t *testing.T) {
+	blob := []byte(strings.Repeat("layer", 1024))
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	var srcGets int
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srcGets++
+		_, _ = w.Write(blob)
+	}))
+	defer src.Close()
+
+	var (
+		uploaded []byte
+		puts     int
+		dst      *httptest.Server
+	)
+	dst = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次上传时模拟 token 过期，读完请求体后要求重新认证
+		if r.Method == http.MethodPut && puts == 0 {
+			puts++
+			_, _ = ioutil.ReadAll(r.Body)
+			r.Header.Del("Authorization")
+		}
+		switch {
+		case r.URL.Path == "/service/token":
+			_, _ = w.Write([]byte(`{"token":"t"}`))
+		case r.Header.Get("Authorization") != "Bearer t":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+dst.URL+`/service/token",service="harbor-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			w.Header().Set("Location", "/v2/lib/app/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut:
+			uploaded, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer dst.Close()
+
+	newClient := func(base string) *registryClient {
+		return &registryClient{base: base, http: http.DefaultClient, tokens: make(map[string]string)}
+	}
+	srcClient, dstClient := newClient(src.URL), newClient(dst.URL)
+	desc := &descriptor{Digest: digest, Size: int64(len(blob))}
+	if err := srcClient.copyBlob(context.Background(), dstClient, "lib/app", "lib/app", desc); err != nil {
+		t.Fatal(err)
+	}
+	if string(uploaded) != string(blob) {
+		t.Errorf("uploaded %v bytes, want %v", len(uploaded), len(blob))
+	}
+	if srcGets != 2 {
+		t.Errorf("source blob fetched %v times, want 2", srcGets)
+	}
+}
@@ -0,0 +1,271 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// GCJob 垃圾回收任务
+type GCJob struct {
+	ID            int64  `json:"id"`
+	JobName       string `json:"job_name"`
+	JobKind       string `json:"job_kind"`
+	JobParameters string `json:"job_parameters"`
+	JobStatus     string `json:"job_status"`
+	Deleted       bool   `json:"deleted"`
+	CreationTime  string `json:"creation_time"`
+	UpdateTime    string `json:"update_time"`
+	Schedule      *struct {
+		Type string `json:"type"`
+		Cron string `json:"cron"`
+	} `json:"schedule"`
+}
+
+type gcParameters struct {
+	DeleteUntagged bool `json:"delete_untagged"`
+	DryRun         bool `json:"dry_run"`
+}
+
+func (j *GCJob) parameters() gcParameters {
+	var p gcParameters
+	_ = json.Unmarshal([]byte(j.JobParameters), &p)
+	return p
+}
+
+func (j *GCJob) finished() bool {
+	switch strings.ToLower(j.JobStatus) {
+	case "success", "error", "stopped", "finished":
+		return true
+	}
+	return false
+}
+
+// GCRun 触发一次垃圾回收，--wait 时等待任务结束并输出释放的空间和日志
+func GCRun(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	body := map[string]interface{}{
+		"schedule": map[string]string{"type": "Manual"},
+		"parameters": gcParameters{
+			DeleteUntagged: ctx.Bool("delete-untagged"),
+			DryRun:         ctx.Bool("dry-run"),
+		},
+	}
+	status, content, err := c.do(sigCtx, http.MethodPost, c.api+"/system/gc/schedule", body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("trigger gc failed: %v", harborError(status, content))
+	}
+
+	jobs, err := getGCJobs(sigCtx, c, 1, 1)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		fmt.Println("gc triggered")
+		return nil
+	}
+	job := jobs[0]
+	fmt.Printf("gc job %v triggered\n", job.ID)
+	if !ctx.Bool("wait") {
+		return nil
+	}
+
+	for !job.finished() {
+		select {
+		case <-sigCtx.Done():
+			fmt.Printf("stop waiting, check the job later with: doo harbor gc status %v\n", job.ID)
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+		if err = c.getJSON(sigCtx, fmt.Sprintf("%s/system/gc/%v", c.api, job.ID), job); err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] gc job %v %s\n", job.ID, job.JobStatus)
+	}
+	return printGCJob(sigCtx, c, job, true)
+}
+
+// GCStatus 输出垃圾回收的定时配置，以及指定任务或最近一次任务的状态、释放的空间和日志
+func GCStatus(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var schedule struct {
+		Schedule *struct {
+			Type string `json:"type"`
+			Cron string `json:"cron"`
+		} `json:"schedule"`
+	}
+	if err = c.getJSON(sigCtx, c.api+"/system/gc/schedule", &schedule); err != nil {
+		return err
+	}
+	if schedule.Schedule != nil && schedule.Schedule.Type != "" && schedule.Schedule.Type != "None" {
+		fmt.Printf("schedule: %s %s\n", schedule.Schedule.Type, schedule.Schedule.Cron)
+	} else {
+		fmt.Println("schedule: none")
+	}
+
+	var job = &GCJob{}
+	if id := ctx.Args().First(); id != "" {
+		if _, err = strconv.ParseInt(id, 10, 64); err != nil {
+			return fmt.Errorf("invalid gc job id %s", id)
+		}
+		if err = c.getJSON(sigCtx, fmt.Sprintf("%s/system/gc/%s", c.api, id), job); err != nil {
+			return err
+		}
+	} else {
+		jobs, err := getGCJobs(sigCtx, c, 1, 1)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			fmt.Println("no gc job found")
+			return nil
+		}
+		job = jobs[0]
+	}
+	return printGCJob(sigCtx, c, job, !ctx.Bool("no-log"))
+}
+
+// GCHistory 列出最近的垃圾回收任务及释放的空间
+func GCHistory(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	jobs, err := getGCJobs(sigCtx, c, 1, ctx.Int("limit"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-8s %-10s %-10s %-18s %-20s %-20s %s\n", "ID", "KIND", "STATUS", "PARAMETERS", "CREATED", "UPDATED", "FREED")
+	for _, job := range jobs {
+		var freed = "-"
+		if log, err := getGCLog(sigCtx, c, job.ID); err == nil {
+			freed = gcFreedSpace(log)
+		}
+		fmt.Printf("%-8v %-10s %-10s %-18s %-20s %-20s %s\n",
+			job.ID, job.kind(), job.JobStatus, job.describeParameters(),
+			formatHarborTime(job.CreationTime), formatHarborTime(job.UpdateTime), freed,
+		)
+	}
+	return nil
+}
+
+func (j *GCJob) kind() string {
+	if j.Schedule != nil && j.Schedule.Type != "" {
+		return j.Schedule.Type
+	}
+	return j.JobKind
+}
+
+func (j *GCJob) describeParameters() string {
+	var (
+		p    = j.parameters()
+		outs = "-"
+	)
+	switch {
+	case p.DryRun && p.DeleteUntagged:
+		outs = "dry-run,untagged"
+	case p.DryRun:
+		outs = "dry-run"
+	case p.DeleteUntagged:
+		outs = "untagged"
+	}
+	return outs
+}
+
+func printGCJob(ctx context.Context, c *Client, job *GCJob, withLog bool) error {
+	fmt.Printf("job: %v\n", job.ID)
+	fmt.Printf("kind: %s\n", job.kind())
+	fmt.Printf("parameters: %s\n", job.describeParameters())
+	fmt.Printf("status: %s\n", job.JobStatus)
+	fmt.Printf("created: %s\n", formatHarborTime(job.CreationTime))
+	fmt.Printf("updated: %s\n", formatHarborTime(job.UpdateTime))
+
+	log, err := getGCLog(ctx, c, job.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("freed: %s\n", gcFreedSpace(log))
+	if withLog {
+		fmt.Printf("\n%s\n", log)
+	}
+	return nil
+}
+
+func getGCJobs(ctx context.Context, c *Client, page, limit int) ([]*GCJob, error) {
+	var outs []*GCJob
+	uri := fmt.Sprintf("%s/system/gc?page=%v&page_size=%v&sort=-creation_time", c.api, page, limit)
+	if err := c.getJSON(ctx, uri, &outs); err != nil {
+		return nil, err
+	}
+	return outs, nil
+}
+
+// getGCLog 获取任务日志，日志接口返回纯文本
+func getGCLog(ctx context.Context, c *Client, id int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/system/gc/%v/log", c.api, id), nil)
+	if err != nil {
+		return "", err
+	}
+	c.setHeader(req)
+	req.Header.Set("Accept", "text/plain")
+	rsp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	content, _ := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK {
+		return "", harborError(rsp.StatusCode, content)
+	}
+	return string(content), nil
+}
+
+var (
+	gcActualFreedExp    = regexp.MustCompile(`actual(?:ly)? frees? up ([0-9.]+ ?[KMGT]?i?B)`)
+	gcEstimatedFreedExp = regexp.MustCompile(`could free up ([0-9.]+ ?[KMGT]?i?B)`)
+)
+
+// gcFreedSpace 从任务日志中解析释放的空间，dry-run 时只有预估值
+func gcFreedSpace(log string) string {
+	if m := gcActualFreedExp.FindStringSubmatch(log); m != nil {
+		return m[1]
+	}
+	if m := gcEstimatedFreedExp.FindStringSubmatch(log); m != nil {
+		return m[1] + " (estimated)"
+	}
+	return "-"
+}
+
+func formatHarborTime(s string) string {
+	t := parseHarborTime(s)
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
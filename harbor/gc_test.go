@@ -0,0 +1,26 @@
+package harbor
+
+import (
+	"testing"
+)
+
+func TestGCFreedSpace(t *testing.T) {
+	cases := []struct {
+		log, want string
+	}{
+		{
+			"2023-01-01T00:00:00Z [INFO] [/jobservice/job/impl/gc/garbage_collection.go:395]: 12 blobs and 3 manifests are actually deleted\n" +
+				"2023-01-01T00:00:00Z [INFO] [/jobservice/job/impl/gc/garbage_collection.go:396]: The GC job actual frees up 34 MB space.\n",
+			"34 MB",
+		},
+		{"The GC job actually frees up 1.5 GiB space.", "1.5 GiB"},
+		{"The GC job could free up 120MB space.\n", "120MB (estimated)"},
+		{"the GC job is interrupted", "-"},
+		{"", "-"},
+	}
+	for _, c := range cases {
+		if got := gcFreedSpace(c.log); got != c.want {
+			t.Errorf("gcFreedSpace(%q) = %q, want %q", c.log, got, c.want)
+		}
+	}
+}
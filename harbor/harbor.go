@@ -1,46 +1,18 @@
 package harbor
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"sasukebo/doo/utils"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
-const (
-	apiAddress = "https://dk.uino.cn/api/v2.0"
-)
-
-type Config struct {
-	Cookie   string `json:"cookie"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Token    string `json:"token"`
-}
-
-func getConfig(ctx *cli.Context) (*Config, error) {
-	configFilePath, err := utils.MustGetStringArg(ctx, "config", "")
-	if err != nil {
-		return nil, err
-	}
-	content, err := os.ReadFile(configFilePath)
-	if err != nil {
-		return nil, err
-	}
-	var config Config
-	_ = json.Unmarshal(content, &config)
-	return &config, nil
-}
-
 func DeleteTagetArtifacts(ctx *cli.Context) error {
 	if ctx.NArg() == 0 {
 		return fmt.Errorf("the reference of the artifact required, can be digest or tag")
@@ -53,7 +25,7 @@ func DeleteTagetArtifacts(ctx *cli.Context) error {
 		reference  = ctx.Args().Get(0)
 	)
 
-	config, err := getConfig(ctx)
+	c, err := newClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -66,180 +38,162 @@ func DeleteTagetArtifacts(ctx *cli.Context) error {
 		return err
 	}
 
-	var url = fmt.Sprintf("%s/projects/%s/repositories/%s/artifacts/%s", apiAddress, project, repository, reference)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	artifact, err := getArtifact(sigCtx, c, project, repository, reference)
 	if err != nil {
 		return err
 	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
+	fmt.Printf("DELETE %s/%s %s %s\n", project, repository, artifact.Digest, artifact.describe())
+	if ctx.Bool("dry-run") {
+		return nil
 	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	var data = make(map[string]interface{})
-	if json.Unmarshal(content, &data) == nil {
-		_content, _ := json.MarshalIndent(&data, "", " ")
-		fmt.Println(string(_content))
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("delete artifact %s?", artifact.Digest)) {
+		fmt.Println("canceled")
+		return nil
 	}
 
+	if err = deleteArtifact(sigCtx, project, repository, artifact.Digest, c); err != nil {
+		return fmt.Errorf("delete %s failed: %v", artifact.Digest, err)
+	}
 	return nil
 }
 
-func setHeader(req *http.Request, config *Config) {
-	req.SetBasicAuth(config.Username, config.Password)
-	req.Header.Add("X-Harbor-CSRF-Token", config.Token)
-	req.Header.Set("Cookie", config.Cookie)
-	req.Header.Set("Accept", "application/json")
+// Repository harbor 仓库，name 包含项目名称，如 library/team/app
+type Repository struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	ArtifactCount int    `json:"artifact_count"`
+	PullCount     int    `json:"pull_count"`
+	CreationTime  string `json:"creation_time"`
+	UpdateTime    string `json:"update_time"`
 }
 
-type repositoryListItem struct {
-	Name string `json:"name"`
+// escapeRepository 仓库名称可以包含多级路径，harbor 要求在 url 中将其编码两次，即 / 编码为 %252F
+func escapeRepository(repo string) string {
+	return url.PathEscape(url.PathEscape(repo))
 }
 
 var ignoreTagExp = regexp.MustCompile(`([123]+\.[0-9]+\.[0-9]+)|staging|test|dev`)
 
 func CleanArtifacts(ctx *cli.Context) error {
-	var (
-		project    string
-		repository string
-		day        int
-		err        error
-	)
-
-	config, err := getConfig(ctx)
+	c, err := newClient(ctx)
 	if err != nil {
 		return err
 	}
-	project, err = utils.MustGetStringArg(ctx, "project", "")
+	policy, err := retentionPolicy(ctx)
 	if err != nil {
 		return err
 	}
-	days, err := utils.MustGetStringArg(ctx, "days_not_pulled", "")
-	if err != nil {
-		return err
-	}
-	day, err = strconv.Atoi(days)
-	if err != nil {
-		return err
-	}
-	disableIgnore := ctx.Bool("disable_ignore")
 
-	repository = ctx.String("repository")
-	var repositories []string
-	if repository != "" {
-		repositories = append(repositories, strings.Split(repository, ",")...)
-	} else {
-		var page, limit = 1, 100
-		for {
-			_repositories, err := getRepositories(project, config, page, limit)
-			if err != nil {
-				return err
-			}
-			repositories = append(repositories, _repositories...)
-			if len(_repositories) < limit {
-				break
-			} else {
-				page++
+	var projects []string
+	if project := ctx.String("project"); project != "" {
+		projects = strings.Split(project, ",")
+	} else if ctx.String("rules") != "" {
+		for _, project := range policy.Projects() {
+			if strings.ContainsAny(project, "*?[") {
+				return fmt.Errorf("project pattern %s in rules requires --project", project)
 			}
+			projects = append(projects, project)
 		}
 	}
-
-	var deleteChan = make(chan *D, 5)
-	var finishChan = make(chan struct{}, 5)
-
-	for i := 0; i < 5; i++ {
-		go func(dc chan *D, fc chan struct{}) {
-			for {
-				select {
-				case d := <-dc:
-					deleteArtifact(project, d.Repo, d.Digest, config)
-					fc <- struct{}{}
-				}
-			}
-		}(deleteChan, finishChan)
+	if len(projects) == 0 {
+		return fmt.Errorf("project is required")
 	}
 
-	for _, repo := range repositories {
-		fmt.Println("[INFO] process repo:", repo)
-		artifacts, err := getTotalArtifacts(project, repo, day, config)
-		if err != nil {
+	var (
+		plans []*cleanPlan
+		count int
+		size  int64
+	)
+	for _, project := range projects {
+		var repositories []string
+		if repository := ctx.String("repository"); repository != "" {
+			repositories = append(repositories, strings.Split(repository, ",")...)
+		} else if repositories, err = getRepositoryNames(ctx.Context, c, project); err != nil {
 			return err
 		}
 
-		var digests []string
-		for _, a := range artifacts {
-			var ignore bool
-			for _, t := range a.Tags {
-				// fmt.Printf("%s %v\n", t.Name, ignoreTagExp.MatchString(t.Name))
-				ignore = ignore || ignoreTagExp.MatchString(t.Name)
-			}
-			if ignore && !disableIgnore {
-				continue
+		for _, repo := range repositories {
+			fmt.Printf("[INFO] process repo: %s/%s\n", project, repo)
+			artifacts, err := getTotalArtifacts(ctx.Context, c, project, repo)
+			if err != nil {
+				return err
 			}
-			digests = append(digests, a.Digest)
-		}
-		var total = len(digests)
-		if total > 0 {
-			go func(dc chan *D, _total *int) {
-				for _, digest := range digests {
-					dc <- &D{repo, digest}
-				}
-			}(deleteChan, &total)
 
-			var finishCount int
-			for {
-				select {
-				case <-finishChan:
-					finishCount++
-				}
-
-				if total == finishCount {
-					break
+			var plan = &cleanPlan{project: project, repo: repo}
+			for _, d := range policy.Evaluate(project, repo, artifacts) {
+				var action = "KEEP"
+				if d.Delete {
+					action = "DELETE"
+					plan.artifacts = append(plan.artifacts, d.Artifact)
+					size += d.Artifact.Size
 				}
+				fmt.Printf("%-6s %s %s, %s\n", action, d.Artifact.Digest, d.Artifact.describe(), d.Reason)
 			}
+			count += len(plan.artifacts)
+			plans = append(plans, plan)
 		}
+	}
 
-		fmt.Println(repo, "find:", len(artifacts), "deleted:", total)
+	fmt.Printf("%v artifacts to delete, %s reclaimable at most after gc\n", count, utils.HumanSize(size))
+	if count == 0 || ctx.Bool("dry-run") {
+		return nil
+	}
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("delete %v artifacts?", count)) {
+		fmt.Println("canceled")
+		return nil
 	}
 
+	var tasks []*deleteTask
+	for _, plan := range plans {
+		for _, a := range plan.artifacts {
+			tasks = append(tasks, &deleteTask{project: plan.project, repo: plan.repo, target: a.Digest})
+		}
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+	runDeletes(sigCtx, ctx.Int("concurrency"), tasks, func(ctx context.Context, t *deleteTask) error {
+		return deleteArtifact(ctx, t.project, t.repo, t.target, c)
+	})
+	if printDeleteSummary(tasks) > 0 {
+		return cli.Exit("", 1)
+	}
 	return nil
 }
 
-type D struct {
-	Repo   string
-	Digest string
+// cleanPlan 一个仓库中待删除的镜像
+type cleanPlan struct {
+	project   string
+	repo      string
+	artifacts []*Artifact
 }
 
-func getRepositories(project string, config *Config, page, limit int) ([]string, error) {
-	var outs []string
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(
-		"%s/projects/%s/repositories?page=%v&page_size=%v",
-		apiAddress, project, page, limit,
-	), nil)
+// retentionPolicy 读取 --rules 指定的保留策略，未指定时使用 --days_not_pulled 和默认的标签过滤规则
+func retentionPolicy(ctx *cli.Context) (*RetentionPolicy, error) {
+	if file := ctx.String("rules"); file != "" {
+		return loadRetentionPolicy(file)
+	}
+
+	days, err := utils.MustGetStringArg(ctx, "days_not_pulled", "")
 	if err != nil {
 		return nil, err
 	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
+	day, err := strconv.Atoi(days)
 	if err != nil {
 		return nil, err
 	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	if rsp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf(string(content))
+	// 与之前按 pull_time 范围查询的行为一致，从未被拉取过的镜像不论推送时间都会被清理
+	var never = 0
+	policy := &RetentionPolicy{Defaults: RetentionRule{NotPulledDays: &day, NeverPulledDays: &never}}
+	if !ctx.Bool("disable_ignore") {
+		policy.Defaults.KeepTags = []string{ignoreTagExp.String()}
 	}
-
-	var repositoryList []*repositoryListItem
-	_ = json.Unmarshal(content, &repositoryList)
-	for _, item := range repositoryList {
-		namePieces := strings.Split(item.Name, "/")
-		if len(namePieces) > 1 {
-			outs = append(outs, namePieces[1])
-		}
+	if err = policy.init(); err != nil {
+		return nil, err
 	}
-
-	return outs, nil
+	return policy, nil
 }
 
 type Tag struct {
@@ -248,46 +202,58 @@ type Tag struct {
 
 type Artifact struct {
 	Digest   string `json:"digest"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+	PushTime string `json:"push_time"`
 	PullTime string `json:"pull_time"`
 	Tags     []*Tag `json:"tags"`
 }
 
-func getArtifacts(project, repo string, config *Config, day, page, limit int) ([]*Artifact, error) {
-	var outs []*Artifact
-	timeRange := fmt.Sprintf(
-		"[\"0001-01-01 00:00:00\"~\"%s 00:00:00\"]",
-		time.Now().Add(time.Duration(-1*day*24*int(time.Hour))).Format("2006-01-02"),
-	)
-	timeRangeEscape := url.PathEscape(timeRange)
+func (a *Artifact) tagNames() string {
+	var names []string
+	for _, t := range a.Tags {
+		names = append(names, t.Name)
+	}
+	return strings.Join(names, ",")
+}
 
+// describe 返回镜像的标签、推送和拉取时间以及大小
+func (a *Artifact) describe() string {
+	var pulled = "never"
+	if t := parseHarborTime(a.PullTime); !t.IsZero() {
+		pulled = t.Local().Format("2006-01-02 15:04")
+	}
+	var pushed = "-"
+	if t := parseHarborTime(a.PushTime); !t.IsZero() {
+		pushed = t.Local().Format("2006-01-02 15:04")
+	}
+	return fmt.Sprintf("[%s] pushed: %s, pulled: %s, size: %s", a.tagNames(), pushed, pulled, utils.HumanSize(a.Size))
+}
+
+// getArtifact 按 digest 或标签获取镜像
+func getArtifact(ctx context.Context, c *Client, project, repo, reference string) (*Artifact, error) {
 	uri := fmt.Sprintf(
-		"%s/projects/%s/repositories/%s/artifacts?page=%v&page_size=%v&sort=pull_time&q=pull_time=%s",
-		apiAddress, project, repo, page, limit, timeRangeEscape,
+		"%s/projects/%s/repositories/%s/artifacts/%s?with_tag=true",
+		c.api, project, escapeRepository(repo), reference,
 	)
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
-	if err != nil {
+	var out Artifact
+	if err := c.getJSON(ctx, uri, &out); err != nil {
 		return nil, err
 	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	if rsp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf(string(content))
-	}
-
-	_ = json.Unmarshal(content, &outs)
-	return outs, nil
+	return &out, nil
 }
 
-func getTotalArtifacts(project, repo string, day int, config *Config) ([]*Artifact, error) {
+// getTotalArtifacts 分页获取仓库下的所有镜像，按拉取时间排序
+func getTotalArtifacts(ctx context.Context, c *Client, project, repo string) ([]*Artifact, error) {
 	var outs []*Artifact
 	var page, limit = 1, 100
 	for {
-		_outs, err := getArtifacts(project, repo, config, day, page, limit)
-		if err != nil {
+		var _outs []*Artifact
+		uri := fmt.Sprintf(
+			"%s/projects/%s/repositories/%s/artifacts?page=%v&page_size=%v&sort=pull_time",
+			c.api, project, escapeRepository(repo), page, limit,
+		)
+		if err := c.getJSON(ctx, uri, &_outs); err != nil {
 			return nil, err
 		}
 		outs = append(outs, _outs...)
@@ -297,35 +263,28 @@ func getTotalArtifacts(project, repo string, day int, config *Config) ([]*Artifa
 			page++
 		}
 	}
-
 	return outs, nil
 }
 
-func deleteArtifact(project, repo, sha string, config *Config) error {
+func deleteArtifact(ctx context.Context, project, repo, sha string, c *Client) error {
 	uri := fmt.Sprintf(
 		"%s/projects/%s/repositories/%s/artifacts/%s",
-		apiAddress, project, repo, sha,
+		c.api, project, escapeRepository(repo), sha,
 	)
-	req, err := http.NewRequest(http.MethodDelete, uri, nil)
+	status, content, err := c.do(ctx, http.MethodDelete, uri, nil)
 	if err != nil {
 		return err
 	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	if rsp.StatusCode != http.StatusOK {
-		return fmt.Errorf(string(content))
+	if status != http.StatusOK {
+		return harborError(status, content)
 	}
 
-	fmt.Printf("DELETE %s ok\n", sha)
+	fmt.Printf("DELETE %s/%s %s ok\n", project, repo, sha)
 	return nil
 }
 
 func DeleteProject(ctx *cli.Context) error {
-	config, err := getConfig(ctx)
+	c, err := newClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -333,87 +292,69 @@ func DeleteProject(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	var repositoryNames []string
-	var page, limit = 1, 100
-	for {
-		names, err := getRepositories(project, config, page, limit)
-		if err != nil {
-			return err
-		}
-		repositoryNames = append(repositoryNames, names...)
-		if len(names) < limit {
-			break
-		} else {
-			page++
-		}
+	repositoryNames, err := getRepositoryNames(ctx.Context, c, project)
+	if err != nil {
+		return err
 	}
 
 	var (
-		deleteChan = make(chan string, 10)
-		finishChan = make(chan struct{}, 5)
+		count int
+		size  int64
 	)
-
-	for i := 0; i < 10; i++ {
-		go func() {
-			for {
-				select {
-				case repo := <-deleteChan:
-					deleteRepository(project, repo, config)
-					finishChan <- struct{}{}
-				}
-			}
-		}()
-	}
-
-	go func() {
-		for _, name := range repositoryNames {
-			deleteChan <- name
-		}
-	}()
-
-	var finished int
-	for {
-		select {
-		case <-finishChan:
-			finished++
+	for _, name := range repositoryNames {
+		artifacts, err := getTotalArtifacts(ctx.Context, c, project, name)
+		if err != nil {
+			return err
 		}
-		if finished == len(repositoryNames) {
-			break
+		fmt.Printf("DELETE repository %s/%s, %v artifacts\n", project, name, len(artifacts))
+		for _, a := range artifacts {
+			fmt.Printf("  %s %s\n", a.Digest, a.describe())
+			size += a.Size
 		}
+		count += len(artifacts)
+	}
+	fmt.Printf("DELETE project %s: %v repositories, %v artifacts, %s reclaimable at most after gc\n", project, len(repositoryNames), count, utils.HumanSize(size))
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("delete project %s?", project)) {
+		fmt.Println("canceled")
+		return nil
 	}
 
-	uri := fmt.Sprintf("%s/projects/%s", apiAddress, project)
-	req, err := http.NewRequest(http.MethodDelete, uri, nil)
-	if err != nil {
-		return err
+	var tasks []*deleteTask
+	for _, name := range repositoryNames {
+		tasks = append(tasks, &deleteTask{project: project, repo: name, target: name})
 	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
+	sigCtx, cancel := signalContext()
+	defer cancel()
+	runDeletes(sigCtx, ctx.Int("concurrency"), tasks, func(ctx context.Context, t *deleteTask) error {
+		return deleteRepository(ctx, t.project, t.repo, c)
+	})
+	if printDeleteSummary(tasks) > 0 {
+		fmt.Printf("project %s is kept because some repositories failed to delete\n", project)
+		return cli.Exit("", 1)
+	}
+
+	status, content, err := c.do(sigCtx, http.MethodDelete, fmt.Sprintf("%s/projects/%s", c.api, project), nil)
 	if err != nil {
 		return err
 	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	if rsp.StatusCode != http.StatusOK {
-		return fmt.Errorf(string(content))
+	if status != http.StatusOK {
+		return fmt.Errorf("delete project %s failed: %v", project, harborError(status, content))
 	}
 	fmt.Printf("%s deleted\n", project)
 	return nil
 }
 
-func deleteRepository(project, repository string, config *Config) error {
-	uri := fmt.Sprintf("%s/projects/%s/repositories/%s", apiAddress, project, repository)
-	req, err := http.NewRequest(http.MethodDelete, uri, nil)
-	if err != nil {
-		return err
-	}
-	setHeader(req, config)
-	rsp, err := http.DefaultClient.Do(req)
+func deleteRepository(ctx context.Context, project, repository string, c *Client) error {
+	uri := fmt.Sprintf("%s/projects/%s/repositories/%s", c.api, project, escapeRepository(repository))
+	status, content, err := c.do(ctx, http.MethodDelete, uri, nil)
 	if err != nil {
 		return err
 	}
-	content, _ := ioutil.ReadAll(rsp.Body)
-	if rsp.StatusCode != http.StatusOK {
-		return fmt.Errorf(string(content))
+	if status != http.StatusOK {
+		return harborError(status, content)
 	}
 
 	fmt.Println("delete", project+"/"+repository)
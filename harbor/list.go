@@ -0,0 +1,171 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Projects 列出项目，可以按名称和公开私有过滤
+func Projects(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	visibility := ctx.String("visibility")
+	if visibility != "" && visibility != "public" && visibility != "private" {
+		return fmt.Errorf("unsupported visibility %s", visibility)
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	projects, err := getProjects(sigCtx, c, ctx.String("name"))
+	if err != nil {
+		return err
+	}
+	var outs []*Project
+	for _, p := range projects {
+		if visibility != "" && p.visibility() != visibility {
+			continue
+		}
+		outs = append(outs, p)
+	}
+	sort.Slice(outs, func(i, j int) bool { return outs[i].Name < outs[j].Name })
+
+	if format == "json" {
+		content, err := json.MarshalIndent(outs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	fmt.Printf("%-8s %-40s %-10s %-8s %s\n", "ID", "Project", "Visibility", "Repos", "Created")
+	for _, p := range outs {
+		fmt.Printf("%-8v %-40s %-10s %-8v %s\n", p.ProjectID, p.Name, p.visibility(), p.RepoCount, formatHarborTime(p.CreationTime))
+	}
+	return nil
+}
+
+func (p *Project) visibility() string {
+	if p.Metadata["public"] == "true" {
+		return "public"
+	}
+	return "private"
+}
+
+// Repos 列出项目下的仓库，包括多级路径的仓库，不指定项目时列出所有项目的仓库
+func Repos(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var projects []string
+	if project := ctx.String("project"); project != "" {
+		projects = strings.Split(project, ",")
+	} else {
+		all, err := getProjects(sigCtx, c, "")
+		if err != nil {
+			return err
+		}
+		for _, p := range all {
+			projects = append(projects, p.Name)
+		}
+	}
+
+	var (
+		outs         []*Repository
+		minArtifacts = ctx.Int("min-artifacts")
+	)
+	for _, project := range projects {
+		repositories, err := getProjectRepositories(sigCtx, c, project, ctx.String("name"))
+		if err != nil {
+			return fmt.Errorf("list repositories of %s failed: %v", project, err)
+		}
+		for _, r := range repositories {
+			if r.ArtifactCount < minArtifacts {
+				continue
+			}
+			outs = append(outs, r)
+		}
+	}
+
+	switch ctx.String("sort") {
+	case "name":
+		sort.Slice(outs, func(i, j int) bool { return outs[i].Name < outs[j].Name })
+	case "artifacts":
+		sort.Slice(outs, func(i, j int) bool { return outs[i].ArtifactCount > outs[j].ArtifactCount })
+	case "pulls":
+		sort.Slice(outs, func(i, j int) bool { return outs[i].PullCount > outs[j].PullCount })
+	case "updated":
+		sort.Slice(outs, func(i, j int) bool { return outs[i].UpdateTime > outs[j].UpdateTime })
+	default:
+		return fmt.Errorf("unsupported sort %s", ctx.String("sort"))
+	}
+
+	if format == "json" {
+		content, err := json.MarshalIndent(outs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	fmt.Printf("%-60s %-10s %-10s %s\n", "Repository", "Artifacts", "Pulls", "Updated")
+	for _, r := range outs {
+		fmt.Printf("%-60s %-10v %-10v %s\n", r.Name, r.ArtifactCount, r.PullCount, formatHarborTime(r.UpdateTime))
+	}
+	return nil
+}
+
+// getRepositoryNames 项目下所有仓库的名称，去掉项目前缀，保留多级路径
+func getRepositoryNames(ctx context.Context, c *Client, project string) ([]string, error) {
+	repositories, err := getProjectRepositories(ctx, c, project, "")
+	if err != nil {
+		return nil, err
+	}
+	var outs []string
+	for _, r := range repositories {
+		outs = append(outs, strings.TrimPrefix(r.Name, project+"/"))
+	}
+	return outs, nil
+}
+
+// getProjectRepositories 分页获取项目下的所有仓库，name 不为空时按名称模糊匹配
+func getProjectRepositories(ctx context.Context, c *Client, project, name string) ([]*Repository, error) {
+	var outs []*Repository
+	var page, limit = 1, 100
+	for {
+		uri := fmt.Sprintf("%s/projects/%s/repositories?page=%v&page_size=%v", c.api, url.PathEscape(project), page, limit)
+		if name != "" {
+			uri += "&q=" + url.QueryEscape("name=~"+name)
+		}
+		var _outs []*Repository
+		if err := c.getJSON(ctx, uri, &_outs); err != nil {
+			return nil, err
+		}
+		outs = append(outs, _outs...)
+		if len(_outs) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	return outs, nil
+}
@@ -0,0 +1,111 @@
+package harbor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// signalContext 收到 Ctrl-C 或 SIGTERM 时取消剩余的删除，再次 Ctrl-C 直接退出
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-ch:
+			fmt.Fprintln(os.Stderr, "[WARN] interrupted, canceling remaining deletions")
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(ch)
+	}()
+	return ctx, cancel
+}
+
+// deleteTask 一次删除操作，target 为镜像 digest 或仓库名称
+type deleteTask struct {
+	project string
+	repo    string
+	target  string
+	err     error
+}
+
+// runDeletes 使用 concurrency 个 worker 执行删除，取消后未开始的任务记为失败
+func runDeletes(ctx context.Context, concurrency int, tasks []*deleteTask, del func(context.Context, *deleteTask) error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	var (
+		taskCh = make(chan *deleteTask)
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range taskCh {
+				t.err = del(ctx, t)
+			}
+		}()
+	}
+
+	var i int
+feed:
+	for ; i < len(tasks); i++ {
+		select {
+		case <-ctx.Done():
+			break feed
+		case taskCh <- tasks[i]:
+		}
+	}
+	close(taskCh)
+	wg.Wait()
+	for ; i < len(tasks); i++ {
+		tasks[i].err = context.Canceled
+	}
+}
+
+// printDeleteSummary 按仓库汇总删除结果，返回失败的数量
+func printDeleteSummary(tasks []*deleteTask) int {
+	type summary struct {
+		deleted int
+		errs    []string
+	}
+	var (
+		repos  []string
+		byRepo = make(map[string]*summary)
+		failed int
+	)
+	for _, t := range tasks {
+		key := t.project + "/" + t.repo
+		s, ok := byRepo[key]
+		if !ok {
+			s = &summary{}
+			byRepo[key] = s
+			repos = append(repos, key)
+		}
+		if t.err != nil {
+			s.errs = append(s.errs, fmt.Sprintf("%s: %v", t.target, t.err))
+			failed++
+			continue
+		}
+		s.deleted++
+	}
+	sort.Strings(repos)
+
+	fmt.Printf("\n*** Summary ***\n")
+	for _, repo := range repos {
+		s := byRepo[repo]
+		fmt.Printf("  %-60s deleted: %v, failed: %v\n", repo, s.deleted, len(s.errs))
+		for _, e := range s.errs {
+			fmt.Printf("    %s\n", e)
+		}
+	}
+	fmt.Printf("  total: %v, deleted: %v, failed: %v\n", len(tasks), len(tasks)-failed, failed)
+	return failed
+}
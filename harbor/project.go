@@ -0,0 +1,835 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sasukebo/doo/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectSpec 项目配置，未设置的字段不会被修改，已存在的项目会按配置调整
+type ProjectSpec struct {
+	Name   string `yaml:"name"`
+	Public *bool  `yaml:"public"`
+	// Quota 存储配额，如 10GiB、500MiB，-1 为不限制
+	Quota string `yaml:"quota"`
+	// AutoScan 推送时自动扫描漏洞
+	AutoScan *bool `yaml:"auto_scan"`
+	// PreventVulnerable 禁止拉取存在不低于该级别漏洞的镜像，none 为不限制
+	PreventVulnerable *string `yaml:"prevent_vulnerable"`
+	// CVEAllowlist 项目级的 CVE 白名单，设置后不再使用系统白名单
+	CVEAllowlist []string         `yaml:"cve_allowlist"`
+	Members      []*MemberSpec    `yaml:"members"`
+	Retention    *RetentionSpec   `yaml:"retention"`
+	Immutable    []*ImmutableSpec `yaml:"immutable"`
+}
+
+// MemberSpec 项目成员，user 和 group 二选一，group 需要已经存在于 harbor 的用户组中
+type MemberSpec struct {
+	User  string `yaml:"user"`
+	Group string `yaml:"group"`
+	// Role 角色 admin、maintainer、developer、guest 或 limited-guest
+	Role string `yaml:"role"`
+}
+
+// RetentionSpec harbor 的项目保留策略，任一规则匹配的镜像会被保留
+type RetentionSpec struct {
+	// Schedule 执行策略的 cron，为空时只能手动执行
+	Schedule string               `yaml:"schedule"`
+	Rules    []*RetentionRuleSpec `yaml:"rules"`
+}
+
+// RetentionRuleSpec 保留规则，keep_last_pushed、keep_last_pulled、pushed_within_days、pulled_within_days 和 always 只能设置一个
+type RetentionRuleSpec struct {
+	Repositories     string `yaml:"repositories"`
+	Tags             string `yaml:"tags"`
+	KeepLastPushed   *int   `yaml:"keep_last_pushed"`
+	KeepLastPulled   *int   `yaml:"keep_last_pulled"`
+	PushedWithinDays *int   `yaml:"pushed_within_days"`
+	PulledWithinDays *int   `yaml:"pulled_within_days"`
+	Always           bool   `yaml:"always"`
+}
+
+// ImmutableSpec 标签不可变规则
+type ImmutableSpec struct {
+	Repositories string `yaml:"repositories"`
+	Tags         string `yaml:"tags"`
+	ExcludeRepos bool   `yaml:"exclude_repos"`
+	ExcludeTags  bool   `yaml:"exclude_tags"`
+}
+
+var memberRoles = map[string]int{
+	"admin":         1,
+	"developer":     2,
+	"guest":         3,
+	"maintainer":    4,
+	"limited-guest": 5,
+}
+
+type projectMember struct {
+	ID         int64  `json:"id"`
+	EntityName string `json:"entity_name"`
+	EntityType string `json:"entity_type"`
+	RoleID     int    `json:"role_id"`
+	RoleName   string `json:"role_name"`
+}
+
+type cveAllowlist struct {
+	Items []struct {
+		CVEID string `json:"cve_id"`
+	} `json:"items"`
+}
+
+type projectRetention struct {
+	ID        int64                   `json:"id,omitempty"`
+	Algorithm string                  `json:"algorithm"`
+	Rules     []*projectRetentionRule `json:"rules"`
+	Trigger   struct {
+		Kind     string            `json:"kind"`
+		Settings map[string]string `json:"settings"`
+	} `json:"trigger"`
+	Scope struct {
+		Level string `json:"level"`
+		Ref   int64  `json:"ref"`
+	} `json:"scope"`
+}
+
+type projectRetentionRule struct {
+	Disabled       bool                       `json:"disabled"`
+	Action         string                     `json:"action"`
+	Template       string                     `json:"template"`
+	Params         map[string]interface{}     `json:"params"`
+	TagSelectors   []*ruleSelector            `json:"tag_selectors"`
+	ScopeSelectors map[string][]*ruleSelector `json:"scope_selectors"`
+}
+
+func (r *projectRetentionRule) describe() string {
+	var repos, tags, params []string
+	for _, s := range r.ScopeSelectors["repository"] {
+		repos = append(repos, s.Decoration+" "+s.Pattern)
+	}
+	for _, s := range r.TagSelectors {
+		tags = append(tags, s.Decoration+" "+s.Pattern)
+	}
+	for k, v := range r.Params {
+		params = append(params, fmt.Sprintf("%s=%v", k, v))
+	}
+	sort.Strings(params)
+	// 除 always 外参数名和模板名相同
+	var template = r.Template
+	if len(params) > 0 {
+		template = strings.Join(params, ",")
+	}
+	return fmt.Sprintf("%s, repositories %s, tags %s", template, strings.Join(repos, ","), strings.Join(tags, ","))
+}
+
+// projectChange 一项待执行的修改，destructive 的修改执行前需要确认
+type projectChange struct {
+	desc        string
+	destructive bool
+	apply       func(ctx context.Context) error
+}
+
+func loadProjectSpecs(file string) ([]*ProjectSpec, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Projects []*ProjectSpec `yaml:"projects"`
+	}
+	if err = yaml.Unmarshal(content, &spec); err != nil {
+		return nil, fmt.Errorf("parse project spec %s failed: %v", file, err)
+	}
+	for _, p := range spec.Projects {
+		if err = p.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return spec.Projects, nil
+}
+
+func (s *ProjectSpec) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required for each project")
+	}
+	if s.Quota != "" {
+		if _, err := parseSize(s.Quota); err != nil {
+			return fmt.Errorf("invalid quota of project %s: %v", s.Name, err)
+		}
+	}
+	if s.PreventVulnerable != nil {
+		if _, ok := severityLevels[strings.ToLower(*s.PreventVulnerable)]; !ok {
+			return fmt.Errorf("unsupported prevent_vulnerable %s of project %s", *s.PreventVulnerable, s.Name)
+		}
+	}
+	for _, m := range s.Members {
+		if (m.User == "") == (m.Group == "") {
+			return fmt.Errorf("one of user and group is required for each member of project %s", s.Name)
+		}
+		if _, ok := memberRoles[m.Role]; !ok {
+			return fmt.Errorf("unsupported role %s of project %s", m.Role, s.Name)
+		}
+	}
+	if s.Retention != nil {
+		for _, r := range s.Retention.Rules {
+			if _, err := r.rule(); err != nil {
+				return fmt.Errorf("invalid retention rule of project %s: %v", s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// metadata 配置中指定的项目元数据
+func (s *ProjectSpec) metadata() map[string]string {
+	var outs = make(map[string]string)
+	if s.Public != nil {
+		outs["public"] = strconv.FormatBool(*s.Public)
+	}
+	if s.AutoScan != nil {
+		outs["auto_scan"] = strconv.FormatBool(*s.AutoScan)
+	}
+	if s.PreventVulnerable != nil {
+		severity := strings.ToLower(*s.PreventVulnerable)
+		if severityLevels[severity] == 0 {
+			outs["prevent_vul"] = "false"
+		} else {
+			outs["prevent_vul"] = "true"
+			outs["severity"] = severity
+		}
+	}
+	if s.CVEAllowlist != nil {
+		outs["reuse_sys_cve_allowlist"] = "false"
+	}
+	return outs
+}
+
+func (s *ProjectSpec) allowlist() *cveAllowlist {
+	if s.CVEAllowlist == nil {
+		return nil
+	}
+	var outs = &cveAllowlist{}
+	for _, id := range s.CVEAllowlist {
+		outs.Items = append(outs.Items, struct {
+			CVEID string `json:"cve_id"`
+		}{id})
+	}
+	return outs
+}
+
+func (r *RetentionRuleSpec) rule() (*projectRetentionRule, error) {
+	var rule = &projectRetentionRule{Action: "retain", Params: map[string]interface{}{}}
+	var count int
+	if r.KeepLastPushed != nil {
+		rule.Template, rule.Params["latestPushedK"] = "latestPushedK", *r.KeepLastPushed
+		count++
+	}
+	if r.KeepLastPulled != nil {
+		rule.Template, rule.Params["latestPulledN"] = "latestPulledN", *r.KeepLastPulled
+		count++
+	}
+	if r.PushedWithinDays != nil {
+		rule.Template, rule.Params["nDaysSinceLastPush"] = "nDaysSinceLastPush", *r.PushedWithinDays
+		count++
+	}
+	if r.PulledWithinDays != nil {
+		rule.Template, rule.Params["nDaysSinceLastPull"] = "nDaysSinceLastPull", *r.PulledWithinDays
+		count++
+	}
+	if r.Always {
+		rule.Template = "always"
+		count++
+	}
+	if count != 1 {
+		return nil, fmt.Errorf("exactly one of keep_last_pushed, keep_last_pulled, pushed_within_days, pulled_within_days and always is required")
+	}
+	repos, tags := r.Repositories, r.Tags
+	if repos == "" {
+		repos = "**"
+	}
+	if tags == "" {
+		tags = "**"
+	}
+	rule.TagSelectors = []*ruleSelector{{Kind: "doublestar", Decoration: "matches", Pattern: tags}}
+	rule.ScopeSelectors = map[string][]*ruleSelector{
+		"repository": {{Kind: "doublestar", Decoration: "repoMatches", Pattern: repos}},
+	}
+	return rule, nil
+}
+
+// ProjectCreate 按配置文件创建项目，项目已存在时调整为配置中的可见性、配额、成员、漏洞扫描、CVE 白名单、保留策略和不可变规则，
+// 可以重复执行，--prune 时删除配置中没有的成员和不可变规则
+func ProjectCreate(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	file, err := utils.MustGetStringArg(ctx, "file", "")
+	if err != nil {
+		return err
+	}
+	specs, err := loadProjectSpecs(file)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() > 0 {
+		var names = make(map[string]struct{})
+		for _, name := range ctx.Args().Slice() {
+			names[name] = struct{}{}
+		}
+		var outs []*ProjectSpec
+		for _, s := range specs {
+			if _, ok := names[s.Name]; ok {
+				outs = append(outs, s)
+			}
+		}
+		specs = outs
+	}
+	if len(specs) == 0 {
+		fmt.Println("no project matched")
+		return nil
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var changes []*projectChange
+	var destructive int
+	for _, s := range specs {
+		_changes, err := planProject(sigCtx, c, s, ctx.Bool("prune"))
+		if err != nil {
+			return fmt.Errorf("plan project %s failed: %v", s.Name, err)
+		}
+		if len(_changes) == 0 {
+			fmt.Printf("project %s is up to date\n", s.Name)
+		}
+		for _, change := range _changes {
+			fmt.Printf("%s: %s\n", s.Name, change.desc)
+			if change.destructive {
+				destructive++
+			}
+		}
+		changes = append(changes, _changes...)
+	}
+	if len(changes) == 0 || ctx.Bool("dry-run") {
+		return nil
+	}
+	if destructive > 0 && !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("apply %v changes, including %v removals?", len(changes), destructive)) {
+		fmt.Println("canceled")
+		return nil
+	}
+	for _, change := range changes {
+		if err := change.apply(sigCtx); err != nil {
+			return fmt.Errorf("%s failed: %v", change.desc, err)
+		}
+	}
+	fmt.Printf("applied %v changes\n", len(changes))
+	return nil
+}
+
+// planProject 比较配置和项目的当前状态，返回需要执行的修改
+func planProject(ctx context.Context, c *Client, s *ProjectSpec, prune bool) ([]*projectChange, error) {
+	var changes []*projectChange
+	project, err := getProjectDetail(ctx, c, s.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if project == nil {
+		var quota int64 = -1
+		if s.Quota != "" {
+			quota, _ = parseSize(s.Quota)
+		}
+		body := map[string]interface{}{
+			"project_name":  s.Name,
+			"metadata":      s.metadata(),
+			"storage_limit": quota,
+		}
+		if allowlist := s.allowlist(); allowlist != nil {
+			body["cve_allowlist"] = allowlist
+		}
+		changes = append(changes, &projectChange{
+			desc: fmt.Sprintf("CREATE project, quota %s", describeQuota(quota)),
+			apply: func(ctx context.Context) error {
+				status, content, err := c.do(ctx, http.MethodPost, c.api+"/projects", body)
+				if err != nil {
+					return err
+				}
+				if status != http.StatusCreated {
+					return harborError(status, content)
+				}
+				return nil
+			},
+		})
+		project = &projectDetail{}
+	} else {
+		var metadata = make(map[string]string)
+		var descs []string
+		for k, v := range s.metadata() {
+			if current := project.Metadata[k]; current != v && !(current == "" && v == "false") {
+				metadata[k] = v
+				descs = append(descs, fmt.Sprintf("%s %q -> %q", k, current, v))
+			}
+		}
+		sort.Strings(descs)
+		allowlist := s.allowlist()
+		if allowlist != nil && strings.Join(allowlist.ids(), ",") != strings.Join(project.CVEAllowlist.ids(), ",") {
+			descs = append(descs, fmt.Sprintf("cve_allowlist [%s] -> [%s]", strings.Join(project.CVEAllowlist.ids(), ","), strings.Join(allowlist.ids(), ",")))
+		} else {
+			allowlist = nil
+		}
+		if len(descs) > 0 {
+			changes = append(changes, &projectChange{
+				desc: "SET " + strings.Join(descs, ", "),
+				apply: func(ctx context.Context) error {
+					return updateProject(ctx, c, s.Name, metadata, allowlist)
+				},
+			})
+		}
+
+		if s.Quota != "" {
+			quota, _ := parseSize(s.Quota)
+			id, current, err := getProjectQuota(ctx, c, project.ProjectID)
+			if err != nil {
+				return nil, err
+			}
+			if current != quota {
+				changes = append(changes, &projectChange{
+					desc: fmt.Sprintf("SET quota %s -> %s", describeQuota(current), describeQuota(quota)),
+					apply: func(ctx context.Context) error {
+						uri := fmt.Sprintf("%s/quotas/%v", c.api, id)
+						status, content, err := c.do(ctx, http.MethodPut, uri, map[string]interface{}{"hard": map[string]int64{"storage": quota}})
+						if err != nil {
+							return err
+						}
+						if status != http.StatusOK {
+							return harborError(status, content)
+						}
+						return nil
+					},
+				})
+			}
+		}
+	}
+
+	memberChanges, err := planMembers(ctx, c, s, project.ProjectID != 0, prune)
+	if err != nil {
+		return nil, err
+	}
+	changes = append(changes, memberChanges...)
+
+	if s.Retention != nil {
+		change, err := planRetention(ctx, c, s, project)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+
+	if s.Immutable != nil {
+		var current []*ImmutableRule
+		if project.ProjectID != 0 {
+			if current, err = getImmutableRules(ctx, c, s.Name); err != nil {
+				return nil, err
+			}
+		}
+		var existing = make(map[string]*ImmutableRule)
+		for _, r := range current {
+			if _, ok := existing[r.describe()]; !ok {
+				existing[r.describe()] = r
+			}
+		}
+		var matched = make(map[int64]bool)
+		for _, spec := range s.Immutable {
+			repos, tags := spec.Repositories, spec.Tags
+			if repos == "" {
+				repos = "**"
+			}
+			if tags == "" {
+				tags = "**"
+			}
+			rule := newImmutableRule(repos, tags, spec.ExcludeRepos, spec.ExcludeTags)
+			if r, ok := existing[rule.describe()]; ok {
+				matched[r.ID] = true
+				continue
+			}
+			changes = append(changes, &projectChange{
+				desc: "ADD immutable rule " + rule.describe(),
+				apply: func(ctx context.Context) error {
+					uri := fmt.Sprintf("%s/projects/%s/immutabletagrules", c.api, s.Name)
+					status, content, err := c.do(ctx, http.MethodPost, uri, rule)
+					if err != nil {
+						return err
+					}
+					if status != http.StatusCreated {
+						return harborError(status, content)
+					}
+					return nil
+				},
+			})
+		}
+		for _, r := range current {
+			if matched[r.ID] || !prune {
+				continue
+			}
+			rule := r
+			changes = append(changes, &projectChange{
+				desc:        fmt.Sprintf("REMOVE immutable rule %v, %s", rule.ID, rule.describe()),
+				destructive: true,
+				apply: func(ctx context.Context) error {
+					uri := fmt.Sprintf("%s/projects/%s/immutabletagrules/%v", c.api, s.Name, rule.ID)
+					status, content, err := c.do(ctx, http.MethodDelete, uri, nil)
+					if err != nil {
+						return err
+					}
+					if status != http.StatusOK {
+						return harborError(status, content)
+					}
+					return nil
+				},
+			})
+		}
+	}
+	return changes, nil
+}
+
+// planMembers 添加缺少的成员并调整角色，prune 时删除配置中没有的成员，当前登录的用户不会被删除，
+// 新建的项目中当前用户已经是管理员，不再重复添加
+func planMembers(ctx context.Context, c *Client, s *ProjectSpec, exists, prune bool) ([]*projectChange, error) {
+	if s.Members == nil {
+		return nil, nil
+	}
+	var current []*projectMember
+	if exists {
+		var err error
+		if current, err = getProjectMembers(ctx, c, s.Name); err != nil {
+			return nil, err
+		}
+	}
+	var existing = make(map[string]*projectMember)
+	for _, m := range current {
+		existing[m.EntityType+"/"+strings.ToLower(m.EntityName)] = m
+	}
+
+	setRole := func(ctx context.Context, memberID int64, roleID int) error {
+		uri := fmt.Sprintf("%s/projects/%s/members/%v", c.api, s.Name, memberID)
+		status, content, err := c.do(ctx, http.MethodPut, uri, map[string]int{"role_id": roleID})
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return harborError(status, content)
+		}
+		return nil
+	}
+
+	var changes []*projectChange
+	for _, m := range s.Members {
+		var key, kind, name = "u/" + strings.ToLower(m.User), "user", m.User
+		if m.Group != "" {
+			key, kind, name = "g/"+strings.ToLower(m.Group), "group", m.Group
+		}
+		roleID := memberRoles[m.Role]
+		if cur, ok := existing[key]; ok {
+			delete(existing, key)
+			if cur.RoleID == roleID {
+				continue
+			}
+			memberID := cur.ID
+			changes = append(changes, &projectChange{
+				desc: fmt.Sprintf("SET role of %s %s %s -> %s", kind, name, cur.RoleName, m.Role),
+				apply: func(ctx context.Context) error {
+					return setRole(ctx, memberID, roleID)
+				},
+			})
+			continue
+		}
+		// 新建项目时当前用户已经是项目管理员，再添加会冲突，只需要调整角色
+		if !exists && key == "u/"+strings.ToLower(c.Username) {
+			if roleID == memberRoles["admin"] {
+				continue
+			}
+			changes = append(changes, &projectChange{
+				desc: fmt.Sprintf("SET role of %s %s admin -> %s", kind, name, m.Role),
+				apply: func(ctx context.Context) error {
+					members, err := getProjectMembers(ctx, c, s.Name)
+					if err != nil {
+						return err
+					}
+					for _, cur := range members {
+						if cur.EntityType+"/"+strings.ToLower(cur.EntityName) == key {
+							return setRole(ctx, cur.ID, roleID)
+						}
+					}
+					return fmt.Errorf("user %s is not a member of project %s", name, s.Name)
+				},
+			})
+			continue
+		}
+
+		var body = map[string]interface{}{"role_id": roleID}
+		if m.Group == "" {
+			body["member_user"] = map[string]string{"username": m.User}
+		} else {
+			groupID, err := findUserGroup(ctx, c, m.Group)
+			if err != nil {
+				return nil, err
+			}
+			body["member_group"] = map[string]int64{"id": groupID}
+		}
+		changes = append(changes, &projectChange{
+			desc: fmt.Sprintf("ADD %s %s as %s", kind, name, m.Role),
+			apply: func(ctx context.Context) error {
+				uri := fmt.Sprintf("%s/projects/%s/members", c.api, s.Name)
+				status, content, err := c.do(ctx, http.MethodPost, uri, body)
+				if err != nil {
+					return err
+				}
+				if status != http.StatusCreated {
+					return harborError(status, content)
+				}
+				return nil
+			},
+		})
+	}
+
+	if !prune {
+		return changes, nil
+	}
+	for _, m := range current {
+		key := m.EntityType + "/" + strings.ToLower(m.EntityName)
+		if _, ok := existing[key]; !ok || key == "u/"+strings.ToLower(c.Username) {
+			continue
+		}
+		memberID := m.ID
+		changes = append(changes, &projectChange{
+			desc:        fmt.Sprintf("REMOVE member %s (%s)", m.EntityName, m.RoleName),
+			destructive: true,
+			apply: func(ctx context.Context) error {
+				uri := fmt.Sprintf("%s/projects/%s/members/%v", c.api, s.Name, memberID)
+				status, content, err := c.do(ctx, http.MethodDelete, uri, nil)
+				if err != nil {
+					return err
+				}
+				if status != http.StatusOK {
+					return harborError(status, content)
+				}
+				return nil
+			},
+		})
+	}
+	return changes, nil
+}
+
+// planRetention 保留策略和配置不一致时整体替换，新建的项目在执行时才能拿到项目 id
+func planRetention(ctx context.Context, c *Client, s *ProjectSpec, project *projectDetail) (*projectChange, error) {
+	var desired = &projectRetention{Algorithm: "or"}
+	for _, r := range s.Retention.Rules {
+		rule, _ := r.rule()
+		desired.Rules = append(desired.Rules, rule)
+	}
+	desired.Trigger.Kind = "Schedule"
+	desired.Trigger.Settings = map[string]string{"cron": s.Retention.Schedule}
+	desired.Scope.Level = "project"
+
+	var current *projectRetention
+	if id := project.Metadata["retention_id"]; id != "" {
+		current = &projectRetention{}
+		if err := c.getJSON(ctx, fmt.Sprintf("%s/retentions/%s", c.api, url.PathEscape(id)), current); err != nil {
+			return nil, err
+		}
+		if describeRetention(current) == describeRetention(desired) {
+			return nil, nil
+		}
+		desired.ID = current.ID
+	}
+
+	desc := "SET retention " + describeRetention(desired)
+	if current != nil {
+		desc = fmt.Sprintf("SET retention %s -> %s", describeRetention(current), describeRetention(desired))
+	}
+	return &projectChange{
+		desc: desc,
+		apply: func(ctx context.Context) error {
+			p, err := getProjectDetail(ctx, c, s.Name)
+			if err != nil {
+				return err
+			}
+			if p == nil {
+				return fmt.Errorf("project %s not found", s.Name)
+			}
+			desired.Scope.Ref = p.ProjectID
+
+			method, uri, expected := http.MethodPost, c.api+"/retentions", http.StatusCreated
+			if id := p.Metadata["retention_id"]; id != "" {
+				method, uri, expected = http.MethodPut, fmt.Sprintf("%s/retentions/%s", c.api, url.PathEscape(id)), http.StatusOK
+			}
+			status, content, err := c.do(ctx, method, uri, desired)
+			if err != nil {
+				return err
+			}
+			if status != expected {
+				return harborError(status, content)
+			}
+			return nil
+		},
+	}, nil
+}
+
+func describeRetention(r *projectRetention) string {
+	var rules []string
+	for _, rule := range r.Rules {
+		if !rule.Disabled {
+			rules = append(rules, rule.describe())
+		}
+	}
+	var cron = r.Trigger.Settings["cron"]
+	if cron == "" {
+		cron = "manual"
+	}
+	return fmt.Sprintf("[%s] schedule %s", strings.Join(rules, "; "), cron)
+}
+
+func describeQuota(quota int64) string {
+	if quota < 0 {
+		return "unlimited"
+	}
+	return utils.HumanSize(quota)
+}
+
+var sizeExp = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// parseSize 解析 10GiB、500M 之类的大小，单位按 1024 换算，-1 为不限制
+func parseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "-1" || s == "unlimited" {
+		return -1, nil
+	}
+	m := sizeExp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	for i := strings.Index("kmgt", m[2]); m[2] != "" && i >= 0; i-- {
+		n *= 1024
+	}
+	return int64(n), nil
+}
+
+// projectDetail 项目及其 CVE 白名单
+type projectDetail struct {
+	Project
+	CVEAllowlist cveAllowlist `json:"cve_allowlist"`
+}
+
+func (l *cveAllowlist) ids() []string {
+	var outs []string
+	for _, item := range l.Items {
+		outs = append(outs, item.CVEID)
+	}
+	sort.Strings(outs)
+	return outs
+}
+
+// getProjectDetail 获取项目，不存在时返回 nil
+func getProjectDetail(ctx context.Context, c *Client, name string) (*projectDetail, error) {
+	status, content, err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%s", c.api, url.PathEscape(name)), nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, harborError(status, content)
+	}
+	var p projectDetail
+	if err = json.Unmarshal(content, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func updateProject(ctx context.Context, c *Client, name string, metadata map[string]string, allowlist *cveAllowlist) error {
+	var body = map[string]interface{}{}
+	if len(metadata) > 0 {
+		body["metadata"] = metadata
+	}
+	if allowlist != nil {
+		body["cve_allowlist"] = allowlist
+	}
+	status, content, err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/projects/%s", c.api, url.PathEscape(name)), body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return harborError(status, content)
+	}
+	return nil
+}
+
+// getProjectQuota 返回项目配额的 id 和存储上限
+func getProjectQuota(ctx context.Context, c *Client, projectID int64) (int64, int64, error) {
+	var quotas []struct {
+		ID   int64            `json:"id"`
+		Hard map[string]int64 `json:"hard"`
+	}
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/quotas?reference=project&reference_id=%v", c.api, projectID), &quotas); err != nil {
+		return 0, 0, err
+	}
+	if len(quotas) == 0 {
+		return 0, 0, fmt.Errorf("quota of project %v not found", projectID)
+	}
+	return quotas[0].ID, quotas[0].Hard["storage"], nil
+}
+
+func getProjectMembers(ctx context.Context, c *Client, project string) ([]*projectMember, error) {
+	var outs []*projectMember
+	var page, limit = 1, 100
+	for {
+		var _outs []*projectMember
+		uri := fmt.Sprintf("%s/projects/%s/members?page=%v&page_size=%v", c.api, url.PathEscape(project), page, limit)
+		if err := c.getJSON(ctx, uri, &_outs); err != nil {
+			return nil, err
+		}
+		outs = append(outs, _outs...)
+		if len(_outs) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	return outs, nil
+}
+
+// findUserGroup 按名称查找 harbor 中已有的用户组
+func findUserGroup(ctx context.Context, c *Client, name string) (int64, error) {
+	var groups []struct {
+		ID        int64  `json:"id"`
+		GroupName string `json:"group_name"`
+	}
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/usergroups/search?groupname=%s", c.api, url.QueryEscape(name)), &groups); err != nil {
+		return 0, err
+	}
+	for _, g := range groups {
+		if strings.EqualFold(g.GroupName, name) {
+			return g.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("user group %s not found", name)
+}
@@ -0,0 +1,69 @@
+package harbor
+
+import (
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		s    string
+		want int64
+		err  bool
+	}{
+		{"-1", -1, false},
+		{"unlimited", -1, false},
+		{"1024", 1024, false},
+		{"10GiB", 10 << 30, false},
+		{"10G", 10 << 30, false},
+		{"1.5 MB", 3 << 19, false},
+		{"512k", 512 << 10, false},
+		{"2TiB", 2 << 40, false},
+		{"10 apples", 0, true},
+		{"", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseSize(c.s)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("parseSize(%q) = %v, %v, want %v, error %v", c.s, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestRetentionRuleSpec(t *testing.T) {
+	cases := []struct {
+		name        string
+		spec        RetentionRuleSpec
+		template    string
+		param       interface{}
+		repos, tags string
+		err         bool
+	}{
+		{"keep last pushed", RetentionRuleSpec{KeepLastPushed: intPtr(10)}, "latestPushedK", 10, "**", "**", false},
+		{"pulled within days", RetentionRuleSpec{Tags: "v*", PulledWithinDays: intPtr(30)}, "nDaysSinceLastPull", 30, "**", "v*", false},
+		{"always", RetentionRuleSpec{Repositories: "team/**", Always: true}, "always", nil, "team/**", "**", false},
+		{"none", RetentionRuleSpec{Tags: "v*"}, "", nil, "", "", true},
+		{"more than one", RetentionRuleSpec{KeepLastPushed: intPtr(1), Always: true}, "", nil, "", "", true},
+	}
+	for _, c := range cases {
+		rule, err := c.spec.rule()
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: got %s, want error", c.name, rule.describe())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if rule.Template != c.template || (c.param != nil && rule.Params[c.template] != c.param) {
+			t.Errorf("%s: template %s %v, want %s %v", c.name, rule.Template, rule.Params, c.template, c.param)
+		}
+		if repos := rule.ScopeSelectors["repository"][0].Pattern; repos != c.repos {
+			t.Errorf("%s: repositories %s, want %s", c.name, repos, c.repos)
+		}
+		if tags := rule.TagSelectors[0].Pattern; tags != c.tags {
+			t.Errorf("%s: tags %s, want %s", c.name, tags, c.tags)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package harbor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RetentionRule 保留规则，未设置的字段继承 defaults 中的值
+type RetentionRule struct {
+	// Project 和 Repository 使用 doublestar 匹配，* 不匹配 /，** 可以匹配多级路径的仓库
+	Project    string `yaml:"project"`
+	Repository string `yaml:"repository"`
+	// KeepLast 保留最近推送的 N 个镜像
+	KeepLast *int `yaml:"keep_last"`
+	// KeepTags 保留标签匹配任一正则的镜像
+	KeepTags []string `yaml:"keep_tags"`
+	// UntaggedDays 删除推送超过 N 天且没有标签的镜像
+	UntaggedDays *int `yaml:"untagged_days"`
+	// NeverPulledDays 删除推送超过 N 天且从未被拉取过的镜像
+	NeverPulledDays *int `yaml:"never_pulled_days"`
+	// NotPulledDays 删除 N 天内没有被拉取过的镜像
+	NotPulledDays *int `yaml:"not_pulled_days"`
+
+	keepTagExps []*regexp.Regexp
+}
+
+// RetentionPolicy 保留策略文件，in_use 中配置的文件或命令输出的镜像会始终保留
+type RetentionPolicy struct {
+	Defaults RetentionRule    `yaml:"defaults"`
+	Rules    []*RetentionRule `yaml:"rules"`
+	InUse    struct {
+		Files    []string `yaml:"files"`
+		Commands []string `yaml:"commands"`
+	} `yaml:"in_use"`
+
+	inUse *inUseImages
+}
+
+func loadRetentionPolicy(file string) (*RetentionPolicy, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var policy RetentionPolicy
+	if err = yaml.Unmarshal(content, &policy); err != nil {
+		return nil, fmt.Errorf("parse retention rules %s failed: %v", file, err)
+	}
+	if err = policy.init(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *RetentionPolicy) init() error {
+	for _, rule := range append([]*RetentionRule{&p.Defaults}, p.Rules...) {
+		for _, t := range rule.KeepTags {
+			exp, err := regexp.Compile(t)
+			if err != nil {
+				return fmt.Errorf("invalid keep_tags pattern %s: %v", t, err)
+			}
+			rule.keepTagExps = append(rule.keepTagExps, exp)
+		}
+	}
+	for _, rule := range p.Rules {
+		if rule.Project == "" {
+			return fmt.Errorf("project is required for each rule")
+		}
+		for _, pattern := range []string{rule.Project, rule.Repository} {
+			if _, err := globRegexp(pattern); err != nil {
+				return fmt.Errorf("invalid pattern %s: %v", pattern, err)
+			}
+		}
+	}
+
+	p.inUse = &inUseImages{digests: make(map[string]struct{}), tags: make(map[string]struct{})}
+	for _, file := range p.InUse.Files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read in use file failed: %v", err)
+		}
+		p.inUse.parse(string(content))
+	}
+	for _, command := range p.InUse.Commands {
+		out, err := exec.Command("sh", "-c", command).Output()
+		if err != nil {
+			return fmt.Errorf("run in use command %s failed: %v", command, err)
+		}
+		p.inUse.parse(string(out))
+	}
+	return nil
+}
+
+// Projects 返回规则中配置的所有项目
+func (p *RetentionPolicy) Projects() []string {
+	var (
+		outs []string
+		seen = make(map[string]struct{})
+	)
+	for _, rule := range p.Rules {
+		if _, ok := seen[rule.Project]; ok {
+			continue
+		}
+		seen[rule.Project] = struct{}{}
+		outs = append(outs, rule.Project)
+	}
+	return outs
+}
+
+// ruleFor 找到第一条匹配项目和仓库的规则，并合并 defaults，规则与 harbor 一样使用 doublestar 匹配
+func (p *RetentionPolicy) ruleFor(project, repo string) *RetentionRule {
+	var rule = p.Defaults
+	for _, r := range p.Rules {
+		if !matchDoublestar(r.Project, project) {
+			continue
+		}
+		// 未指定仓库时匹配项目下所有仓库，包括多级路径的仓库
+		if r.Repository != "" && !matchDoublestar(r.Repository, repo) {
+			continue
+		}
+		if r.KeepLast != nil {
+			rule.KeepLast = r.KeepLast
+		}
+		if r.KeepTags != nil {
+			rule.KeepTags, rule.keepTagExps = r.KeepTags, r.keepTagExps
+		}
+		if r.UntaggedDays != nil {
+			rule.UntaggedDays = r.UntaggedDays
+		}
+		if r.NeverPulledDays != nil {
+			rule.NeverPulledDays = r.NeverPulledDays
+		}
+		if r.NotPulledDays != nil {
+			rule.NotPulledDays = r.NotPulledDays
+		}
+		break
+	}
+	return &rule
+}
+
+// Decision 对一个镜像的处理结果及原因
+type Decision struct {
+	Artifact *Artifact
+	Delete   bool
+	Reason   string
+}
+
+// Evaluate 按规则评估仓库中的所有镜像，依次检查：正在使用、最近推送、标签匹配、无标签、从未拉取、长期未拉取
+func (p *RetentionPolicy) Evaluate(project, repo string, artifacts []*Artifact) []*Decision {
+	rule := p.ruleFor(project, repo)
+	sorted := append([]*Artifact{}, artifacts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].PushTime > sorted[j].PushTime })
+
+	var (
+		outs []*Decision
+		now  = time.Now()
+	)
+	for i, a := range sorted {
+		d := &Decision{Artifact: a}
+		outs = append(outs, d)
+
+		if p.inUse != nil && p.inUse.contains(project, repo, a) {
+			d.Reason = "in use by running workloads"
+			continue
+		}
+		if rule.KeepLast != nil && i < *rule.KeepLast {
+			d.Reason = fmt.Sprintf("within last %v pushed", *rule.KeepLast)
+			continue
+		}
+		if tag := rule.matchTag(a); tag != "" {
+			d.Reason = fmt.Sprintf("tag %s matches keep_tags", tag)
+			continue
+		}
+
+		pushed := parseHarborTime(a.PushTime)
+		pulled := parseHarborTime(a.PullTime)
+		if rule.UntaggedDays != nil && len(a.Tags) == 0 && olderThan(pushed, now, *rule.UntaggedDays) {
+			d.Delete, d.Reason = true, fmt.Sprintf("untagged and pushed more than %v days ago", *rule.UntaggedDays)
+			continue
+		}
+		if rule.NeverPulledDays != nil && pulled.IsZero() && olderThan(pushed, now, *rule.NeverPulledDays) {
+			d.Delete, d.Reason = true, fmt.Sprintf("never pulled and pushed more than %v days ago", *rule.NeverPulledDays)
+			continue
+		}
+		if rule.NotPulledDays != nil {
+			last := pulled
+			if last.IsZero() {
+				last = pushed
+			}
+			if olderThan(last, now, *rule.NotPulledDays) {
+				d.Delete, d.Reason = true, fmt.Sprintf("not pulled in %v days", *rule.NotPulledDays)
+				continue
+			}
+		}
+		d.Reason = "no delete rule matched"
+	}
+	return outs
+}
+
+func (r *RetentionRule) matchTag(a *Artifact) string {
+	for _, t := range a.Tags {
+		for _, exp := range r.keepTagExps {
+			if exp.MatchString(t.Name) {
+				return t.Name
+			}
+		}
+	}
+	return ""
+}
+
+// globRegexp 将 doublestar 模式转换为正则：** 匹配任意多级路径，* 和 ? 不匹配 /，[...] 为字符集
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				switch {
+				case i+1 < len(pattern) && pattern[i+1] == '/':
+					// **/ 可以匹配零级目录
+					i++
+					b.WriteString("(?:.*/)?")
+				case b.Len() > 1 && strings.HasSuffix(b.String(), "/"):
+					// /** 可以匹配目录本身
+					s := strings.TrimSuffix(b.String(), "/")
+					b.Reset()
+					b.WriteString(s + "(?:/.*)?")
+				default:
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			if j < 0 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			class := pattern[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func matchDoublestar(pattern, name string) bool {
+	exp, err := globRegexp(pattern)
+	return err == nil && exp.MatchString(name)
+}
+
+func olderThan(t, now time.Time, days int) bool {
+	return !t.IsZero() && now.Sub(t) > time.Duration(days)*24*time.Hour
+}
+
+// parseHarborTime 解析 harbor 返回的时间，从未拉取时 pull_time 为 0001-01-01T00:00:00.000Z
+func parseHarborTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil || t.Year() <= 1 {
+		return time.Time{}
+	}
+	return t
+}
+
+// inUseImages 正在使用的镜像，可以是 kubectl 等命令输出的 image 或 imageID
+type inUseImages struct {
+	digests map[string]struct{}
+	tags    map[string]struct{}
+}
+
+var imageRefExp = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9._\-/:]*(?:@sha256:[a-f0-9]{64}|:[A-Za-z0-9._\-]+)`)
+
+func (u *inUseImages) parse(content string) {
+	for _, ref := range imageRefExp.FindAllString(content, -1) {
+		if i := strings.Index(ref, "@sha256:"); i >= 0 {
+			u.digests[ref[i+1:]] = struct{}{}
+			continue
+		}
+		i := strings.LastIndex(ref, ":")
+		name, tag := ref[:i], ref[i+1:]
+		// 去掉镜像仓库域名，只保留 project/repository
+		if pieces := strings.SplitN(name, "/", 2); len(pieces) == 2 && strings.ContainsAny(pieces[0], ".:") {
+			name = pieces[1]
+		}
+		u.tags[name+":"+tag] = struct{}{}
+	}
+}
+
+func (u *inUseImages) contains(project, repo string, a *Artifact) bool {
+	if _, ok := u.digests[a.Digest]; ok {
+		return true
+	}
+	for _, t := range a.Tags {
+		if _, ok := u.tags[project+"/"+repo+":"+t.Name]; ok {
+			return true
+		}
+	}
+	return false
+}
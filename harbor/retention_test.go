@@ -0,0 +1,181 @@
+package harbor
+
+import (
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// testArtifact 构造测试镜像，pulled 小于 0 表示从未被拉取
+func testArtifact(digest string, pushed, pulled int, tags ...string) *Artifact {
+	now := time.Now().UTC()
+	a := &Artifact{
+		Digest:   digest,
+		PushTime: now.Add(-time.Duration(pushed) * 24 * time.Hour).Format(time.RFC3339Nano),
+		PullTime: "0001-01-01T00:00:00.000Z",
+	}
+	if pulled >= 0 {
+		a.PullTime = now.Add(-time.Duration(pulled) * 24 * time.Hour).Format(time.RFC3339Nano)
+	}
+	for _, t := range tags {
+		a.Tags = append(a.Tags, &Tag{Name: t})
+	}
+	return a
+}
+
+func TestRuleFor(t *testing.T) {
+	policy := &RetentionPolicy{
+		Defaults: RetentionRule{KeepLast: intPtr(10), NotPulledDays: intPtr(90)},
+		Rules: []*RetentionRule{
+			{Project: "lib", Repository: "app", KeepLast: intPtr(3)},
+			{Project: "lib", Repository: "infra/**", KeepLast: intPtr(5)},
+			{Project: "lib", NotPulledDays: intPtr(30)},
+			{Project: "team-*", UntaggedDays: intPtr(7)},
+		},
+	}
+	if err := policy.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		project, repo string
+		keepLast      int
+		notPulled     int
+		untagged      *int
+	}{
+		{"lib", "app", 3, 90, nil},
+		{"lib", "other", 10, 30, nil},
+		{"lib", "team/api", 10, 30, nil},
+		{"lib", "infra/db/mysql", 5, 90, nil},
+		{"team-a", "app", 10, 90, intPtr(7)},
+		{"unknown", "app", 10, 90, nil},
+	}
+	for _, c := range cases {
+		rule := policy.ruleFor(c.project, c.repo)
+		if *rule.KeepLast != c.keepLast {
+			t.Errorf("%s/%s: keep_last = %v, want %v", c.project, c.repo, *rule.KeepLast, c.keepLast)
+		}
+		if *rule.NotPulledDays != c.notPulled {
+			t.Errorf("%s/%s: not_pulled_days = %v, want %v", c.project, c.repo, *rule.NotPulledDays, c.notPulled)
+		}
+		if (rule.UntaggedDays == nil) != (c.untagged == nil) || (c.untagged != nil && *rule.UntaggedDays != *c.untagged) {
+			t.Errorf("%s/%s: untagged_days = %v, want %v", c.project, c.repo, rule.UntaggedDays, c.untagged)
+		}
+	}
+	if policy.Defaults.KeepLast == nil || *policy.Defaults.KeepLast != 10 {
+		t.Errorf("defaults modified by ruleFor")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	cases := []struct {
+		name      string
+		rule      RetentionRule
+		inUse     string
+		artifacts []*Artifact
+		deleted   []string
+	}{
+		{
+			name:      "keep last pushed",
+			rule:      RetentionRule{KeepLast: intPtr(2), NotPulledDays: intPtr(1)},
+			artifacts: []*Artifact{testArtifact("a", 30, 10), testArtifact("b", 20, 10), testArtifact("c", 10, 10)},
+			deleted:   []string{"a"},
+		},
+		{
+			name:      "keep tags",
+			rule:      RetentionRule{KeepTags: []string{`^v\d+`}, NotPulledDays: intPtr(1)},
+			artifacts: []*Artifact{testArtifact("a", 30, 10, "v1.0.0"), testArtifact("b", 30, 10, "dev")},
+			deleted:   []string{"b"},
+		},
+		{
+			name:      "untagged",
+			rule:      RetentionRule{UntaggedDays: intPtr(7)},
+			artifacts: []*Artifact{testArtifact("a", 10, 1), testArtifact("b", 3, -1), testArtifact("c", 10, -1, "latest")},
+			deleted:   []string{"a"},
+		},
+		{
+			name:      "never pulled",
+			rule:      RetentionRule{NeverPulledDays: intPtr(7)},
+			artifacts: []*Artifact{testArtifact("a", 10, -1, "x"), testArtifact("b", 3, -1, "y"), testArtifact("c", 10, 5, "z")},
+			deleted:   []string{"a"},
+		},
+		{
+			name:      "not pulled falls back to push time",
+			rule:      RetentionRule{NotPulledDays: intPtr(30)},
+			artifacts: []*Artifact{testArtifact("a", 60, 40, "x"), testArtifact("b", 60, 10, "y"), testArtifact("c", 10, -1, "z"), testArtifact("d", 60, -1, "w")},
+			deleted:   []string{"a", "d"},
+		},
+		{
+			name:      "legacy days_not_pulled deletes all never pulled",
+			rule:      RetentionRule{NotPulledDays: intPtr(30), NeverPulledDays: intPtr(0)},
+			artifacts: []*Artifact{testArtifact("a", 60, 40), testArtifact("b", 1, -1), testArtifact("c", 60, 10)},
+			deleted:   []string{"a", "b"},
+		},
+		{
+			name:      "in use",
+			rule:      RetentionRule{NotPulledDays: intPtr(1)},
+			inUse:     "harbor.example.com/lib/app:v1\n",
+			artifacts: []*Artifact{testArtifact("a", 30, 10, "v1"), testArtifact("b", 30, 10, "v2")},
+			deleted:   []string{"b"},
+		},
+		{
+			name:      "no delete rule",
+			rule:      RetentionRule{},
+			artifacts: []*Artifact{testArtifact("a", 300, -1)},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := &RetentionPolicy{Defaults: c.rule}
+			if err := policy.init(); err != nil {
+				t.Fatal(err)
+			}
+			policy.inUse.parse(c.inUse)
+
+			var want = make(map[string]bool)
+			for _, d := range c.deleted {
+				want[d] = true
+			}
+			decisions := policy.Evaluate("lib", "app", c.artifacts)
+			if len(decisions) != len(c.artifacts) {
+				t.Fatalf("got %v decisions, want %v", len(decisions), len(c.artifacts))
+			}
+			for _, d := range decisions {
+				if d.Delete != want[d.Artifact.Digest] {
+					t.Errorf("%s: delete = %v (%s), want %v", d.Artifact.Digest, d.Delete, d.Reason, want[d.Artifact.Digest])
+				}
+			}
+		})
+	}
+}
+
+func TestMatchDoublestar(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "app", true},
+		{"*", "team/api", false},
+		{"**", "team/api/v1", true},
+		{"team/*", "team/api", true},
+		{"team/*", "team/api/v1", false},
+		{"team/**", "team/api/v1", true},
+		{"team/**", "team", true},
+		{"team/**", "teams/api", false},
+		{"**/api", "api", true},
+		{"**/api", "a/b/api", true},
+		{"**/api", "a/b/apis", false},
+		{"app-?", "app-1", true},
+		{"app-[0-9]", "app-x", false},
+		{"app-[!0-9]", "app-x", true},
+		{"lib.app", "libxapp", false},
+	}
+	for _, c := range cases {
+		if got := matchDoublestar(c.pattern, c.name); got != c.want {
+			t.Errorf("matchDoublestar(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
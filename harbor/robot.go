@@ -0,0 +1,321 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sasukebo/doo/gitlab/client"
+	"sasukebo/doo/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Robot harbor 机器人账号，level 为 system 时可以访问多个项目
+type Robot struct {
+	ID           int64              `json:"id,omitempty"`
+	Name         string             `json:"name"`
+	Description  string             `json:"description"`
+	Secret       string             `json:"secret,omitempty"`
+	Level        string             `json:"level"`
+	Duration     int                `json:"duration"`
+	Disable      bool               `json:"disable"`
+	ExpiresAt    int64              `json:"expires_at,omitempty"`
+	CreationTime string             `json:"creation_time,omitempty"`
+	Permissions  []*robotPermission `json:"permissions"`
+}
+
+type robotPermission struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace"`
+	Access    []*robotAccess `json:"access"`
+}
+
+type robotAccess struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+func (r *Robot) expires() string {
+	if r.ExpiresAt <= 0 {
+		return "never"
+	}
+	t := time.Unix(r.ExpiresAt, 0)
+	if t.Before(time.Now()) {
+		return t.Format("2006-01-02") + " (expired)"
+	}
+	return t.Format("2006-01-02")
+}
+
+func (r *Robot) describePermissions() string {
+	var outs []string
+	for _, p := range r.Permissions {
+		var access []string
+		for _, a := range p.Access {
+			access = append(access, a.Resource+":"+a.Action)
+		}
+		outs = append(outs, fmt.Sprintf("%s[%s]", p.Namespace, strings.Join(access, ",")))
+	}
+	return strings.Join(outs, " ")
+}
+
+// parseRobotAccess 解析 resource:action 格式的权限，多个用逗号分隔
+func parseRobotAccess(s string) ([]*robotAccess, error) {
+	var outs []*robotAccess
+	for _, item := range strings.Split(s, ",") {
+		pieces := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(pieces) != 2 || pieces[0] == "" || pieces[1] == "" {
+			return nil, fmt.Errorf("invalid access %s, should be resource:action like repository:pull", item)
+		}
+		outs = append(outs, &robotAccess{Resource: pieces[0], Action: pieces[1]})
+	}
+	return outs, nil
+}
+
+// RobotCreate 创建机器人账号，只指定一个项目时创建项目级账号，--system 时创建系统级账号，密钥只输出一次
+func RobotCreate(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("robot name required")
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	access, err := parseRobotAccess(ctx.String("access"))
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var projects []string
+	if p := ctx.String("project"); p != "" {
+		projects = strings.Split(p, ",")
+	}
+	robot := &Robot{
+		Name:        ctx.Args().First(),
+		Description: ctx.String("description"),
+		Level:       "project",
+		Duration:    ctx.Int("days"),
+	}
+	if ctx.Bool("system") {
+		robot.Level = "system"
+		if len(projects) == 0 {
+			projects = []string{"*"}
+		}
+	} else if len(projects) != 1 {
+		return fmt.Errorf("project robot requires exactly one --project, use --system for multiple projects")
+	}
+	for _, p := range projects {
+		robot.Permissions = append(robot.Permissions, &robotPermission{Kind: "project", Namespace: p, Access: access})
+	}
+
+	status, content, err := c.do(sigCtx, http.MethodPost, c.api+"/robots", robot)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("create robot failed: %v", harborError(status, content))
+	}
+	var created Robot
+	if err = json.Unmarshal(content, &created); err != nil {
+		return err
+	}
+	fmt.Printf("created robot %s (id %v), expires: %s\n", created.Name, created.ID, created.expires())
+	return outputRobotSecret(ctx, c, created.Name, created.Secret)
+}
+
+// RobotList 列出机器人账号，指定 --project 时只列出可以访问该项目的账号
+func RobotList(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	robots, err := getRobots(sigCtx, c)
+	if err != nil {
+		return err
+	}
+	project := ctx.String("project")
+	fmt.Printf("%-8s %-40s %-8s %-9s %-22s %s\n", "ID", "Name", "Level", "Disabled", "Expires", "Permissions")
+	for _, r := range robots {
+		if project != "" {
+			var matched bool
+			for _, p := range r.Permissions {
+				matched = matched || p.Namespace == project || p.Namespace == "*"
+			}
+			if !matched {
+				continue
+			}
+		}
+		fmt.Printf("%-8v %-40s %-8s %-9v %-22s %s\n", r.ID, r.Name, r.Level, r.Disable, r.expires(), r.describePermissions())
+	}
+	return nil
+}
+
+// RobotRemove 删除机器人账号，可以使用 id 或名称
+func RobotRemove(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("robot id or name required")
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var robots []*Robot
+	for _, arg := range ctx.Args().Slice() {
+		r, err := findRobot(sigCtx, c, arg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("DELETE robot %s (id %v), permissions: %s\n", r.Name, r.ID, r.describePermissions())
+		robots = append(robots, r)
+	}
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("delete %v robots?", len(robots))) {
+		fmt.Println("canceled")
+		return nil
+	}
+	for _, r := range robots {
+		status, content, err := c.do(sigCtx, http.MethodDelete, fmt.Sprintf("%s/robots/%v", c.api, r.ID), nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("delete robot %s failed: %v", r.Name, harborError(status, content))
+		}
+		fmt.Printf("deleted robot %s\n", r.Name)
+	}
+	return nil
+}
+
+// RobotRefresh 重新生成机器人账号的密钥，指定 --days 时同时更新有效期
+func RobotRefresh(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("robot id or name required")
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	r, err := findRobot(sigCtx, c, ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	if ctx.IsSet("days") {
+		r.Duration = ctx.Int("days")
+		status, content, err := c.do(sigCtx, http.MethodPut, fmt.Sprintf("%s/robots/%v", c.api, r.ID), r)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("update robot %s failed: %v", r.Name, harborError(status, content))
+		}
+		if r, err = findRobot(sigCtx, c, strconv.FormatInt(r.ID, 10)); err != nil {
+			return err
+		}
+	}
+
+	status, content, err := c.do(sigCtx, http.MethodPatch, fmt.Sprintf("%s/robots/%v", c.api, r.ID), map[string]string{"secret": ""})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("refresh robot %s failed: %v", r.Name, harborError(status, content))
+	}
+	var sec struct {
+		Secret string `json:"secret"`
+	}
+	if err = json.Unmarshal(content, &sec); err != nil {
+		return err
+	}
+	fmt.Printf("refreshed robot %s (id %v), expires: %s\n", r.Name, r.ID, r.expires())
+	return outputRobotSecret(ctx, c, r.Name, sec.Secret)
+}
+
+// outputRobotSecret 输出密钥，指定 --gitlab-project 时同时写入 gitlab 项目的 CI/CD 变量
+func outputRobotSecret(ctx *cli.Context, c *Client, name, secret string) error {
+	fmt.Printf("secret: %s\n", secret)
+	fmt.Println("the secret is only shown once, keep it safe")
+
+	project := ctx.String("gitlab-project")
+	if project == "" {
+		return nil
+	}
+	if err := client.Init(ctx); err != nil {
+		return err
+	}
+	var (
+		prefix    = ctx.String("gitlab-prefix")
+		protected = ctx.Bool("protected")
+		registry  = c.URL
+	)
+	if u, err := url.Parse(c.api); err == nil && u.Host != "" {
+		registry = u.Host
+	}
+	for _, v := range []struct {
+		key    string
+		value  string
+		masked bool
+	}{
+		{prefix + "REGISTRY", registry, false},
+		{prefix + "USERNAME", name, false},
+		{prefix + "PASSWORD", secret, true},
+	} {
+		if err := client.SetProjectVariable(project, v.key, v.value, v.masked, protected); err != nil {
+			return fmt.Errorf("set gitlab variable %s of %s failed: %v", v.key, project, err)
+		}
+		fmt.Printf("set gitlab variable %s of %s\n", v.key, project)
+	}
+	return nil
+}
+
+func getRobots(ctx context.Context, c *Client) ([]*Robot, error) {
+	var outs []*Robot
+	var page, limit = 1, 100
+	for {
+		var _outs []*Robot
+		if err := c.getJSON(ctx, fmt.Sprintf("%s/robots?page=%v&page_size=%v", c.api, page, limit), &_outs); err != nil {
+			return nil, err
+		}
+		outs = append(outs, _outs...)
+		if len(_outs) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	return outs, nil
+}
+
+// findRobot 按 id 或名称查找机器人账号，名称可以省略 robot$ 前缀
+func findRobot(ctx context.Context, c *Client, idOrName string) (*Robot, error) {
+	if _, err := strconv.ParseInt(idOrName, 10, 64); err == nil {
+		var r Robot
+		if err := c.getJSON(ctx, fmt.Sprintf("%s/robots/%s", c.api, idOrName), &r); err != nil {
+			return nil, err
+		}
+		return &r, nil
+	}
+	robots, err := getRobots(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range robots {
+		if r.Name == idOrName || strings.TrimPrefix(r.Name, "robot$") == strings.TrimPrefix(idOrName, "robot$") {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("robot %s not found", idOrName)
+}
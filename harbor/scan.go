@@ -0,0 +1,320 @@
+package harbor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var severityLevels = map[string]int{
+	"unknown":    0,
+	"none":       0,
+	"negligible": 1,
+	"low":        2,
+	"medium":     3,
+	"high":       4,
+	"critical":   5,
+}
+
+type scanOverview struct {
+	ReportID    string `json:"report_id"`
+	ScanStatus  string `json:"scan_status"`
+	Severity    string `json:"severity"`
+	StartTime   string `json:"start_time"`
+	EndTime     string `json:"end_time"`
+	CompletePct int    `json:"complete_percent"`
+	Summary     *struct {
+		Total   int            `json:"total"`
+		Fixable int            `json:"fixable"`
+		Summary map[string]int `json:"summary"`
+	} `json:"summary"`
+}
+
+type vulnerability struct {
+	ID         string `json:"id"`
+	Package    string `json:"package"`
+	Version    string `json:"version"`
+	FixVersion string `json:"fix_version"`
+	Severity   string `json:"severity"`
+}
+
+// scanTarget 需要扫描的镜像及扫描结果
+type scanTarget struct {
+	ref      *imageRef
+	tags     string
+	previous string
+	overview *scanOverview
+	err      error
+}
+
+// done 扫描结束或出错，触发扫描前的结果不算作本次扫描的结果
+func (t *scanTarget) done() bool {
+	if t.err != nil {
+		return true
+	}
+	if t.overview == nil || (t.previous != "" && t.overview.StartTime == t.previous) {
+		return false
+	}
+	switch strings.ToLower(t.overview.ScanStatus) {
+	case "success", "error", "stopped":
+		return true
+	}
+	return false
+}
+
+// countAtLeast 统计不低于指定级别的漏洞数量
+func (t *scanTarget) countAtLeast(level int) int {
+	var count int
+	if t.overview == nil || t.overview.Summary == nil {
+		return 0
+	}
+	for severity, n := range t.overview.Summary.Summary {
+		if severityLevels[strings.ToLower(severity)] >= level {
+			count += n
+		}
+	}
+	return count
+}
+
+// Scan 触发镜像的漏洞扫描并等待完成，输出每个镜像各级别的漏洞数量和漏洞列表，--fail-on 时存在对应级别的漏洞返回非 0
+func Scan(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	failOn, show := -1, 0
+	if v := ctx.String("fail-on"); v != "" {
+		level, ok := severityLevels[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("unsupported severity %s", v)
+		}
+		failOn = level
+	}
+	if v := ctx.String("show"); v != "" {
+		level, ok := severityLevels[strings.ToLower(v)]
+		if !ok {
+			return fmt.Errorf("unsupported severity %s", v)
+		}
+		show = level
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	targets, err := scanTargets(sigCtx, ctx, c)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		fmt.Println("no artifact matched")
+		return nil
+	}
+
+	for _, t := range targets {
+		previous, err := getScanOverview(sigCtx, c, t.ref)
+		if err != nil {
+			t.err = err
+			continue
+		}
+		if previous != nil {
+			t.previous = previous.StartTime
+		}
+		uri := fmt.Sprintf(
+			"%s/projects/%s/repositories/%s/artifacts/%s/scan",
+			c.api, t.ref.project, escapeRepository(t.ref.repo), t.ref.reference,
+		)
+		status, content, err := c.do(sigCtx, http.MethodPost, uri, nil)
+		if sigCtx.Err() != nil {
+			return sigCtx.Err()
+		}
+		if err != nil {
+			t.err = fmt.Errorf("trigger scan failed: %v", err)
+			continue
+		}
+		if status != http.StatusAccepted {
+			t.err = fmt.Errorf("trigger scan failed: %v", harborError(status, content))
+			continue
+		}
+		fmt.Printf("[INFO] scan %s triggered\n", t.ref)
+	}
+
+	deadline := time.Now().Add(ctx.Duration("timeout"))
+	for {
+		var pending int
+		for _, t := range targets {
+			if t.done() {
+				continue
+			}
+			if t.overview, err = getScanOverview(sigCtx, c, t.ref); err != nil {
+				t.err = err
+				continue
+			}
+			if !t.done() {
+				pending++
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			for _, t := range targets {
+				if !t.done() {
+					t.err = fmt.Errorf("scan not finished in %v", ctx.Duration("timeout"))
+				}
+			}
+			break
+		}
+		select {
+		case <-sigCtx.Done():
+			return sigCtx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	var failed int
+	for _, t := range targets {
+		fmt.Printf("\n*** %s [%s] ***\n", t.ref, t.tags)
+		if t.err != nil {
+			fmt.Printf("  error: %v\n", t.err)
+			failed++
+			continue
+		}
+		if strings.ToLower(t.overview.ScanStatus) != "success" {
+			fmt.Printf("  scan %s\n", t.overview.ScanStatus)
+			failed++
+			continue
+		}
+		var summary = map[string]int{}
+		var total, fixable int
+		if t.overview.Summary != nil {
+			total, fixable = t.overview.Summary.Total, t.overview.Summary.Fixable
+			for k, v := range t.overview.Summary.Summary {
+				summary[strings.ToLower(k)] = v
+			}
+		}
+		fmt.Printf(
+			"  critical: %v, high: %v, medium: %v, low: %v, total: %v, fixable: %v\n",
+			summary["critical"], summary["high"], summary["medium"], summary["low"], total, fixable,
+		)
+		if total > 0 {
+			vulns, err := getVulnerabilities(sigCtx, c, t.ref)
+			if err != nil {
+				fmt.Printf("  get vulnerabilities failed: %v\n", err)
+			}
+			for _, v := range vulns {
+				if severityLevels[strings.ToLower(v.Severity)] < show {
+					continue
+				}
+				var fix = "no fix"
+				if v.FixVersion != "" {
+					fix = "fixed in " + v.FixVersion
+				}
+				fmt.Printf("  %-10s %-20s %s %s, %s\n", strings.ToUpper(v.Severity), v.ID, v.Package, v.Version, fix)
+			}
+		}
+		if failOn >= 0 && t.countAtLeast(failOn) > 0 {
+			fmt.Printf("  [FAIL] found vulnerabilities at or above %s\n", ctx.String("fail-on"))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+// scanTargets 参数中的镜像，或按 --project、--repository 和 --tag 过滤出的有标签的镜像
+func scanTargets(ctx context.Context, cliCtx *cli.Context, c *Client) ([]*scanTarget, error) {
+	var targets []*scanTarget
+	for _, arg := range cliCtx.Args().Slice() {
+		ref, err := parseImageRef(arg, true)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, &scanTarget{ref: ref, tags: ref.reference})
+	}
+	if len(targets) > 0 {
+		return targets, nil
+	}
+
+	project := cliCtx.String("project")
+	if project == "" {
+		return nil, fmt.Errorf("image arguments or --project is required")
+	}
+	repositories, err := getRepositoryNames(ctx, c, project)
+	if err != nil {
+		return nil, err
+	}
+
+	repoPattern, tagPattern := cliCtx.String("repository"), cliCtx.String("tag")
+	for _, repo := range repositories {
+		if ok, _ := path.Match(repoPattern, repo); repoPattern != "" && !ok {
+			continue
+		}
+		artifacts, err := getTotalArtifacts(ctx, c, project, repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range artifacts {
+			var matched bool
+			for _, t := range a.Tags {
+				if ok, _ := path.Match(tagPattern, t.Name); ok {
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+			targets = append(targets, &scanTarget{
+				ref:  &imageRef{project: project, repo: repo, reference: a.Digest},
+				tags: a.tagNames(),
+			})
+		}
+	}
+	return targets, nil
+}
+
+func getScanOverview(ctx context.Context, c *Client, ref *imageRef) (*scanOverview, error) {
+	var a struct {
+		ScanOverview map[string]*scanOverview `json:"scan_overview"`
+	}
+	uri := fmt.Sprintf(
+		"%s/projects/%s/repositories/%s/artifacts/%s?with_scan_overview=true",
+		c.api, ref.project, escapeRepository(ref.repo), ref.reference,
+	)
+	if err := c.getJSON(ctx, uri, &a); err != nil {
+		return nil, err
+	}
+	for _, o := range a.ScanOverview {
+		return o, nil
+	}
+	return nil, nil
+}
+
+func getVulnerabilities(ctx context.Context, c *Client, ref *imageRef) ([]*vulnerability, error) {
+	var reports map[string]*struct {
+		Vulnerabilities []*vulnerability `json:"vulnerabilities"`
+	}
+	uri := fmt.Sprintf(
+		"%s/projects/%s/repositories/%s/artifacts/%s/additions/vulnerabilities",
+		c.api, ref.project, escapeRepository(ref.repo), ref.reference,
+	)
+	if err := c.getJSON(ctx, uri, &reports); err != nil {
+		return nil, err
+	}
+	var outs []*vulnerability
+	for _, r := range reports {
+		if r != nil {
+			outs = append(outs, r.Vulnerabilities...)
+		}
+	}
+	sort.SliceStable(outs, func(i, j int) bool {
+		return severityLevels[strings.ToLower(outs[i].Severity)] > severityLevels[strings.ToLower(outs[j].Severity)]
+	})
+	return outs, nil
+}
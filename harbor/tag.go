@@ -0,0 +1,349 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sasukebo/doo/utils"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+type artifactTag struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	PushTime  string `json:"push_time"`
+	PullTime  string `json:"pull_time"`
+	Immutable bool   `json:"immutable"`
+}
+
+func tagsURI(c *Client, ref *imageRef, reference string) string {
+	return fmt.Sprintf("%s/projects/%s/repositories/%s/artifacts/%s/tags", c.api, ref.project, escapeRepository(ref.repo), reference)
+}
+
+// TagList 列出镜像的所有标签
+func TagList(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("usage: tag ls <project/repo:tag|@digest>")
+	}
+	ref, err := parseImageRef(ctx.Args().First(), true)
+	if err != nil {
+		return err
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var tags []*artifactTag
+	var page, limit = 1, 100
+	for {
+		var _tags []*artifactTag
+		uri := fmt.Sprintf("%s?page=%v&page_size=%v", tagsURI(c, ref, ref.reference), page, limit)
+		if err := c.getJSON(sigCtx, uri, &_tags); err != nil {
+			return err
+		}
+		tags = append(tags, _tags...)
+		if len(_tags) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	fmt.Printf("%-40s %-10s %-20s %s\n", "Tag", "Immutable", "Pushed", "Pulled")
+	for _, t := range tags {
+		fmt.Printf("%-40s %-10v %-20s %s\n", t.Name, t.Immutable, formatHarborTime(t.PushTime), formatHarborTime(t.PullTime))
+	}
+	return nil
+}
+
+// TagAdd 给镜像添加标签
+func TagAdd(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("usage: tag add <project/repo:tag|@digest> <tag>...")
+	}
+	ref, err := parseImageRef(ctx.Args().First(), true)
+	if err != nil {
+		return err
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	for _, tag := range ctx.Args().Tail() {
+		if err := addTag(sigCtx, c, ref, ref.reference, tag); err != nil {
+			return err
+		}
+		fmt.Printf("tagged %s as %s\n", ref, tag)
+	}
+	return nil
+}
+
+// TagRemove 删除标签，镜像本身不会被删除
+func TagRemove(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("usage: tag rm <project/repo:tag>...")
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	for _, arg := range ctx.Args().Slice() {
+		ref, err := parseImageRef(arg, true)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(ref.reference, "sha256:") {
+			return fmt.Errorf("%s is not a tag", arg)
+		}
+		if err := removeTag(sigCtx, c, ref, ref.reference, ref.reference); err != nil {
+			return err
+		}
+		fmt.Printf("untagged %s\n", ref)
+	}
+	return nil
+}
+
+// Retag 将标签移动到同一仓库的另一个镜像上，如把 latest 指向新的 digest，添加失败时恢复原标签
+func Retag(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("usage: retag <project/repo:tag> <digest|tag>")
+	}
+	ref, err := parseImageRef(ctx.Args().Get(0), true)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(ref.reference, "sha256:") {
+		return fmt.Errorf("%s is not a tag", ctx.Args().Get(0))
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	target, err := getArtifact(sigCtx, c, ref.project, ref.repo, ctx.Args().Get(1))
+	if err != nil {
+		return fmt.Errorf("get target artifact failed: %v", err)
+	}
+	current, err := findArtifact(sigCtx, c, ref)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		// 标签不存在时直接添加
+		if err := addTag(sigCtx, c, ref, target.Digest, ref.reference); err != nil {
+			return err
+		}
+		fmt.Printf("tagged %s@%s as %s\n", ref.name(), target.Digest, ref.reference)
+		return nil
+	}
+	if current.Digest == target.Digest {
+		fmt.Printf("%s already points to %s\n", ref, target.Digest)
+		return nil
+	}
+
+	fmt.Printf("move %s from %s to %s\n", ref, current.Digest, target.Digest)
+	if !ctx.Bool("yes") && !utils.Confirm(fmt.Sprintf("retag %s?", ref)) {
+		fmt.Println("canceled")
+		return nil
+	}
+	if err = removeTag(sigCtx, c, ref, current.Digest, ref.reference); err != nil {
+		return err
+	}
+	if err = addTag(sigCtx, c, ref, target.Digest, ref.reference); err != nil {
+		if rerr := addTag(sigCtx, c, ref, current.Digest, ref.reference); rerr != nil {
+			return fmt.Errorf("%v, and restore tag to %s failed: %v", err, current.Digest, rerr)
+		}
+		return fmt.Errorf("%v, tag restored to %s", err, current.Digest)
+	}
+	fmt.Printf("%s now points to %s\n", ref, target.Digest)
+	return nil
+}
+
+// findArtifact 获取引用对应的镜像，不存在时返回 nil
+func findArtifact(ctx context.Context, c *Client, ref *imageRef) (*Artifact, error) {
+	uri := fmt.Sprintf("%s/projects/%s/repositories/%s/artifacts/%s", c.api, ref.project, escapeRepository(ref.repo), ref.reference)
+	status, content, err := c.do(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, harborError(status, content)
+	}
+	var a Artifact
+	if err = json.Unmarshal(content, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func addTag(ctx context.Context, c *Client, ref *imageRef, reference, tag string) error {
+	status, content, err := c.do(ctx, http.MethodPost, tagsURI(c, ref, reference), map[string]string{"name": tag})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("add tag %s failed: %v", tag, harborError(status, content))
+	}
+	return nil
+}
+
+func removeTag(ctx context.Context, c *Client, ref *imageRef, reference, tag string) error {
+	uri := tagsURI(c, ref, reference) + "/" + url.PathEscape(tag)
+	status, content, err := c.do(ctx, http.MethodDelete, uri, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("remove tag %s failed: %v", tag, harborError(status, content))
+	}
+	return nil
+}
+
+// ImmutableRule 标签不可变规则，匹配的标签不能被覆盖或删除
+type ImmutableRule struct {
+	ID             int64                      `json:"id,omitempty"`
+	Disabled       bool                       `json:"disabled"`
+	Action         string                     `json:"action"`
+	Template       string                     `json:"template"`
+	TagSelectors   []*ruleSelector            `json:"tag_selectors"`
+	ScopeSelectors map[string][]*ruleSelector `json:"scope_selectors"`
+}
+
+type ruleSelector struct {
+	Kind       string `json:"kind"`
+	Decoration string `json:"decoration"`
+	Pattern    string `json:"pattern"`
+}
+
+func newImmutableRule(repos, tags string, excludeRepos, excludeTags bool) *ImmutableRule {
+	repoDecoration, tagDecoration := "repoMatches", "matches"
+	if excludeRepos {
+		repoDecoration = "repoExcludes"
+	}
+	if excludeTags {
+		tagDecoration = "excludes"
+	}
+	return &ImmutableRule{
+		Action:       "immutable",
+		Template:     "immutable_template",
+		TagSelectors: []*ruleSelector{{Kind: "doublestar", Decoration: tagDecoration, Pattern: tags}},
+		ScopeSelectors: map[string][]*ruleSelector{
+			"repository": {{Kind: "doublestar", Decoration: repoDecoration, Pattern: repos}},
+		},
+	}
+}
+
+func (r *ImmutableRule) describe() string {
+	var repos, tags []string
+	for _, s := range r.ScopeSelectors["repository"] {
+		repos = append(repos, s.Decoration+" "+s.Pattern)
+	}
+	for _, s := range r.TagSelectors {
+		tags = append(tags, s.Decoration+" "+s.Pattern)
+	}
+	return fmt.Sprintf("repositories %s, tags %s", strings.Join(repos, ","), strings.Join(tags, ","))
+}
+
+func getImmutableRules(ctx context.Context, c *Client, project string) ([]*ImmutableRule, error) {
+	var outs []*ImmutableRule
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/projects/%s/immutabletagrules", c.api, project), &outs); err != nil {
+		return nil, err
+	}
+	return outs, nil
+}
+
+// ImmutableList 列出项目的标签不可变规则
+func ImmutableList(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	project, err := utils.MustGetStringArg(ctx, "project", "")
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	rules, err := getImmutableRules(sigCtx, c, project)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-8s %-10s %s\n", "ID", "Disabled", "Rule")
+	for _, r := range rules {
+		fmt.Printf("%-8v %-10v %s\n", r.ID, r.Disabled, r.describe())
+	}
+	return nil
+}
+
+// ImmutableAdd 添加标签不可变规则，规则使用 doublestar 匹配，如 ** 或 v*
+func ImmutableAdd(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	project, err := utils.MustGetStringArg(ctx, "project", "")
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	rule := newImmutableRule(ctx.String("repos"), ctx.String("tags"), ctx.Bool("exclude-repos"), ctx.Bool("exclude-tags"))
+	status, content, err := c.do(sigCtx, http.MethodPost, fmt.Sprintf("%s/projects/%s/immutabletagrules", c.api, project), rule)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("add immutable rule failed: %v", harborError(status, content))
+	}
+	fmt.Printf("added immutable rule to %s: %s\n", project, rule.describe())
+	return nil
+}
+
+// ImmutableRemove 删除标签不可变规则
+func ImmutableRemove(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("rule id required")
+	}
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	project, err := utils.MustGetStringArg(ctx, "project", "")
+	if err != nil {
+		return err
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	for _, id := range ctx.Args().Slice() {
+		uri := fmt.Sprintf("%s/projects/%s/immutabletagrules/%s", c.api, project, url.PathEscape(id))
+		status, content, err := c.do(sigCtx, http.MethodDelete, uri, nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("remove immutable rule %s failed: %v", id, harborError(status, content))
+		}
+		fmt.Printf("removed immutable rule %s\n", id)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package harbor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sasukebo/doo/utils"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Project harbor 项目
+type Project struct {
+	ProjectID    int64             `json:"project_id"`
+	Name         string            `json:"name"`
+	RepoCount    int               `json:"repo_count"`
+	CreationTime string            `json:"creation_time"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+type repositoryUsage struct {
+	Repository      string `json:"repository"`
+	Artifacts       int    `json:"artifacts"`
+	Size            int64  `json:"size"`
+	Untagged        int    `json:"untagged"`
+	UntaggedSize    int64  `json:"untagged_size"`
+	NeverPulled     int    `json:"never_pulled"`
+	NeverPulledSize int64  `json:"never_pulled_size"`
+}
+
+type projectUsage struct {
+	Project         string             `json:"project"`
+	QuotaUsed       int64              `json:"quota_used"`
+	QuotaHard       int64              `json:"quota_hard"`
+	Artifacts       int                `json:"artifacts"`
+	Size            int64              `json:"size"`
+	UntaggedSize    int64              `json:"untagged_size"`
+	NeverPulledSize int64              `json:"never_pulled_size"`
+	Repositories    []*repositoryUsage `json:"repositories"`
+}
+
+// Usage 统计各项目的配额使用、仓库和镜像数量，以及每个仓库的镜像大小、无标签和从未拉取的镜像占用
+func Usage(ctx *cli.Context) error {
+	c, err := newClient(ctx)
+	if err != nil {
+		return err
+	}
+	format := ctx.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported format %s", format)
+	}
+	sigCtx, cancel := signalContext()
+	defer cancel()
+
+	var names []string
+	if project := ctx.String("project"); project != "" {
+		names = strings.Split(project, ",")
+	} else {
+		projects, err := getProjects(sigCtx, c, "")
+		if err != nil {
+			return err
+		}
+		for _, p := range projects {
+			names = append(names, p.Name)
+		}
+	}
+
+	var (
+		reports []*projectUsage
+		failed  int
+	)
+	for _, name := range names {
+		if sigCtx.Err() != nil {
+			return sigCtx.Err()
+		}
+		pu, err := getProjectUsage(sigCtx, c, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "--- [ERROR] get usage of project %s failed: %v\n", name, err)
+			failed++
+			continue
+		}
+		reports = append(reports, pu)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].QuotaUsed > reports[j].QuotaUsed })
+
+	if format == "json" {
+		content, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return usageFailed(failed)
+	}
+
+	fmt.Printf("%-30s %-22s %-8s %-10s %-10s %-10s %-10s\n", "Project", "Quota", "Repos", "Artifacts", "Size", "Untagged", "NeverPulled")
+	for _, pu := range reports {
+		var quota = utils.HumanSize(pu.QuotaUsed) + " / unlimited"
+		if pu.QuotaHard > 0 {
+			quota = fmt.Sprintf("%s / %s", utils.HumanSize(pu.QuotaUsed), utils.HumanSize(pu.QuotaHard))
+		}
+		fmt.Printf(
+			"%-30s %-22s %-8v %-10v %-10s %-10s %-10s\n",
+			pu.Project, quota, len(pu.Repositories), pu.Artifacts,
+			utils.HumanSize(pu.Size), utils.HumanSize(pu.UntaggedSize), utils.HumanSize(pu.NeverPulledSize),
+		)
+	}
+
+	top := ctx.Int("top")
+	for _, pu := range reports {
+		fmt.Printf("\n*** %s 占用最大的 %v 个仓库 ***\n", pu.Project, top)
+		fmt.Printf("  %-50s %-10s %-10s %-20s %-20s\n", "Repository", "Artifacts", "Size", "Untagged", "NeverPulled")
+		for i, ru := range pu.Repositories {
+			if i >= top {
+				break
+			}
+			fmt.Printf(
+				"  %-50s %-10v %-10s %-20s %-20s\n",
+				ru.Repository, ru.Artifacts, utils.HumanSize(ru.Size),
+				fmt.Sprintf("%v (%s)", ru.Untagged, utils.HumanSize(ru.UntaggedSize)),
+				fmt.Sprintf("%v (%s)", ru.NeverPulled, utils.HumanSize(ru.NeverPulledSize)),
+			)
+		}
+	}
+	fmt.Println("\n镜像大小按每个镜像单独累加，共享的层会重复计算，配额为去重后的实际占用")
+	return usageFailed(failed)
+}
+
+func usageFailed(failed int) error {
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "--- [ERROR] %v projects failed, the report is incomplete\n", failed)
+		return cli.Exit("", 1)
+	}
+	return nil
+}
+
+func getProjectUsage(ctx context.Context, c *Client, project string) (*projectUsage, error) {
+	var summary struct {
+		Quota *struct {
+			Hard map[string]int64 `json:"hard"`
+			Used map[string]int64 `json:"used"`
+		} `json:"quota"`
+	}
+	if err := c.getJSON(ctx, fmt.Sprintf("%s/projects/%s/summary", c.api, url.PathEscape(project)), &summary); err != nil {
+		return nil, err
+	}
+	pu := &projectUsage{Project: project}
+	if summary.Quota != nil {
+		pu.QuotaUsed, pu.QuotaHard = summary.Quota.Used["storage"], summary.Quota.Hard["storage"]
+	}
+
+	repositories, err := getRepositoryNames(ctx, c, project)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repositories {
+		artifacts, err := getTotalArtifacts(ctx, c, project, repo)
+		if err != nil {
+			return nil, err
+		}
+		ru := &repositoryUsage{Repository: repo, Artifacts: len(artifacts)}
+		for _, a := range artifacts {
+			ru.Size += a.Size
+			if len(a.Tags) == 0 {
+				ru.Untagged++
+				ru.UntaggedSize += a.Size
+			}
+			if parseHarborTime(a.PullTime).IsZero() {
+				ru.NeverPulled++
+				ru.NeverPulledSize += a.Size
+			}
+		}
+		pu.Repositories = append(pu.Repositories, ru)
+		pu.Artifacts += ru.Artifacts
+		pu.Size += ru.Size
+		pu.UntaggedSize += ru.UntaggedSize
+		pu.NeverPulledSize += ru.NeverPulledSize
+	}
+	sort.Slice(pu.Repositories, func(i, j int) bool { return pu.Repositories[i].Size > pu.Repositories[j].Size })
+	return pu, nil
+}
+
+// getProjects 分页获取所有项目，name 不为空时按名称模糊匹配
+func getProjects(ctx context.Context, c *Client, name string) ([]*Project, error) {
+	var outs []*Project
+	var page, limit = 1, 100
+	for {
+		uri := fmt.Sprintf("%s/projects?page=%v&page_size=%v&with_detail=true", c.api, page, limit)
+		if name != "" {
+			uri += "&name=" + url.QueryEscape(name)
+		}
+		var _outs []*Project
+		if err := c.getJSON(ctx, uri, &_outs); err != nil {
+			return nil, err
+		}
+		outs = append(outs, _outs...)
+		if len(_outs) < limit {
+			break
+		} else {
+			page++
+		}
+	}
+	return outs, nil
+}
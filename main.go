@@ -7,6 +7,7 @@ import (
 	"sasukebo/doo/harbor"
 	"sasukebo/doo/utils"
 	"sasukebo/doo/vultr"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -82,6 +83,246 @@ var _gitlab = &cli.Command{
 			},
 			Action: gitlab.ForceDeleteTag,
 		},
+		{
+			Name:  "stale",
+			Usage: "list projects without commits, merge requests or pipelines in N days",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only check target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.IntFlag{Name: "days", Usage: "no activity in `DAYS`", Aliases: []string{"d"}, Value: 180},
+				&cli.BoolFlag{Name: "archive", Usage: "archive the stale projects"},
+				&cli.BoolFlag{Name: "dry-run", Usage: "only print the projects to be archived"},
+				&cli.BoolFlag{Name: "yes", Usage: "skip confirmation", Aliases: []string{"y"}},
+			},
+			Action: gitlab.StaleProjects,
+		},
+		{
+			Name:      "unarchive",
+			Usage:     "unarchive projects, all archived projects of target groups if no project given",
+			ArgsUsage: "[group/project ...]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only unarchive projects of target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{Name: "dry-run", Usage: "only print the projects to be unarchived"},
+				&cli.BoolFlag{Name: "yes", Usage: "skip confirmation", Aliases: []string{"y"}},
+			},
+			Action: gitlab.UnarchiveProjects,
+		},
+		{
+			Name:  "storage",
+			Usage: "report repository, lfs, artifacts, packages and registry sizes of your gitlab projects",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only report target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "format", Usage: "output `FORMAT`, table or json", Aliases: []string{"f"}, Value: "table"},
+				&cli.IntFlag{Name: "top", Usage: "show `N` biggest offenders", Value: 10},
+				&cli.IntFlag{Name: "job-pages", Usage: "check never-expiring artifacts in the latest `N` pages of 100 jobs per project, 0 to check all jobs", Value: 10},
+			},
+			Action: gitlab.StorageSummary,
+		},
+		{
+			Name:      "move",
+			Usage:     "transfer projects matching the pattern to target group, and relocate local clones",
+			ArgsUsage: "<src-pattern> <dest-group>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{Name: "rename", Usage: "rename the project to `PATH`, only for single project"},
+				&cli.BoolFlag{Name: "dry-run", Usage: "only print the projects to be transferred"},
+				&cli.BoolFlag{Name: "yes", Usage: "skip confirmation", Aliases: []string{"y"}},
+			},
+			Action: gitlab.MoveProjects,
+		},
+		{
+			Name:      "grep",
+			Usage:     "search regex across all synced projects in parallel",
+			ArgsUsage: "<regex>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only search target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "projects", Usage: "only search projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "lang", Usage: "only search files of `LANGUAGES`, seperated by comma", Aliases: []string{"l"}},
+				&cli.StringFlag{Name: "branch", Usage: "search `BRANCH` instead of the working tree", Aliases: []string{"b"}},
+				&cli.BoolFlag{Name: "ignore-case", Usage: "case insensitive", Aliases: []string{"i"}},
+				&cli.IntFlag{Name: "jobs", Usage: "search `N` projects in parallel, default number of cpus", Aliases: []string{"j"}},
+			},
+			Action: gitlab.Grep,
+		},
+		{
+			Name:      "foreach",
+			Usage:     "run a shell command in each synced project",
+			ArgsUsage: "-- <script> | -- <cmd> <args>...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only run in target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "projects", Usage: "only run in projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "if-exists", Usage: "only run in projects containing files matching `GLOB`, e.g. go.mod"},
+				&cli.IntFlag{Name: "jobs", Usage: "run in `N` projects in parallel, default number of cpus", Aliases: []string{"j"}},
+			},
+			Action: gitlab.Foreach,
+		},
+		{
+			Name:  "batch-change",
+			Usage: "ship the same change to many synced projects with merge requests",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:      "apply",
+					Usage:     "create branch, apply script or patch, commit, push and open merge request in each project",
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "groups",
+							Usage:   "only change target groups, seperated by comma",
+							Aliases: []string{"g"},
+						},
+						&cli.StringFlag{Name: "projects", Usage: "only change projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+						&cli.StringFlag{Name: "if-exists", Usage: "only change projects containing files matching `GLOB`, e.g. Dockerfile"},
+						&cli.StringFlag{Name: "script", Usage: "shell `SCRIPT` to run in each project", Aliases: []string{"s"}},
+						&cli.StringFlag{Name: "patch", Usage: "`PATCH` file to apply with git apply"},
+						&cli.StringFlag{Name: "title", Usage: "commit and merge request `TITLE`"},
+						&cli.StringFlag{Name: "description", Usage: "merge request `DESCRIPTION`", Aliases: []string{"d"}},
+						&cli.StringFlag{Name: "branch", Usage: "source `BRANCH`, default doo/<name>", Aliases: []string{"b"}},
+						&cli.BoolFlag{Name: "update", Usage: "re-apply to projects with opened merge requests"},
+					},
+					Action: gitlab.BatchChangeApply,
+				},
+				{
+					Name:      "status",
+					Usage:     "refresh and show merge request status of the change set",
+					ArgsUsage: "<name>",
+					Action:    gitlab.BatchChangeStatus,
+				},
+				{
+					Name:      "close",
+					Usage:     "close all opened merge requests of the change set",
+					ArgsUsage: "<name>",
+					Action:    gitlab.BatchChangeClose,
+				},
+			},
+		},
+		{
+			Name:  "deps",
+			Usage: "dependency inventory of go.mod, package.json (versions locked by package-lock.json, yarn.lock or pnpm-lock.yaml), requirements and pyproject.toml across synced projects",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only scan target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "projects", Usage: "only scan projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "module", Usage: "only show modules matching `REGEX`", Aliases: []string{"m"}},
+				&cli.StringFlag{Name: "version", Usage: "only show modules used with `VERSION`, other versions are still listed", Aliases: []string{"v"}},
+				&cli.BoolFlag{Name: "skew", Usage: "only show modules used with different versions"},
+				&cli.StringFlag{Name: "format", Usage: "output `FORMAT`, table, json or csv", Aliases: []string{"f"}, Value: "table"},
+				&cli.StringFlag{Name: "output", Usage: "write to `FILE` instead of stdout", Aliases: []string{"o"}},
+			},
+			Action: gitlab.DependencyInventory,
+		},
+		{
+			Name:      "release",
+			Usage:     "create tag and release with changelog generated from merge requests and conventional commits",
+			ArgsUsage: "<group/project> <tag>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "ref", Usage: "create tag from `REF`, default branch of the project if not set"},
+				&cli.StringFlag{Name: "previous", Usage: "generate changelog since `TAG`, latest tag if not set"},
+				&cli.BoolFlag{Name: "dry-run", Usage: "only print the release notes"},
+			},
+			Action: gitlab.CreateRelease,
+		},
+		{
+			Name:  "serve-hooks",
+			Usage: "serve gitlab webhooks and sync only the affected projects to local",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{Name: "secret", Usage: "webhook secret token, same as env `DOO_GITLAB_HOOK_SECRET`", Aliases: []string{"s"}},
+				&cli.StringFlag{Name: "addr", Usage: "listen `ADDR`", Value: ":8080"},
+				&cli.IntFlag{Name: "jobs", Usage: "sync `N` projects in parallel", Aliases: []string{"j"}, Value: 2},
+			},
+			Action: gitlab.ServeHooks,
+		},
+		{
+			Name:  "export",
+			Usage: "export issues, merge requests, notes, labels and milestones next to the synced projects",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "root",
+					Usage:   "root path, same as env `DOO_GITLAB_SYNC_ROOT`",
+					Aliases: []string{"r"},
+				},
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only export target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "projects", Usage: "only export projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+				&cli.BoolFlag{Name: "render", Usage: "only re-render markdown from the exported files, without requesting gitlab"},
+			},
+			Action: gitlab.ExportProjects,
+		},
+		{
+			Name:  "mirror",
+			Usage: "mirror groups and projects with all branches and tags to another gitlab, github or gitea",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "to", Usage: "target `HOST` or url, e.g. gitlab.backup.com or http://localhost:3000", Required: true},
+				&cli.StringFlag{Name: "to-token", Usage: "target access token, same as env `DOO_GITLAB_MIRROR_TOKEN`"},
+				&cli.StringFlag{Name: "to-type", Usage: "target `TYPE`, gitlab, github or gitea", Value: "gitlab"},
+				&cli.StringFlag{Name: "to-user", Usage: "`USERNAME` for pushing to target", Value: "oauth2"},
+				&cli.StringFlag{Name: "namespace", Usage: "put mirrored groups under `NAMESPACE` of target"},
+				&cli.StringFlag{
+					Name:    "groups",
+					Usage:   "only mirror target groups, seperated by comma",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{Name: "projects", Usage: "only mirror projects matching `PATTERNS`, seperated by comma", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "cache", Usage: "`DIR` of the local bare repositories for incremental updates"},
+				&cli.BoolFlag{Name: "dry-run", Usage: "only print the projects to be mirrored"},
+			},
+			Action: gitlab.Mirror,
+		},
 	},
 }
 
@@ -100,7 +341,8 @@ var _harbor = &cli.Command{
 	Name:  "harbor",
 	Usage: "执行一些Harbor的辅助功能",
 	Flags: []cli.Flag{
-		&cli.StringFlag{Name: "config", Usage: "指定Harbor api v2.0的Authorization信息文件地址", Aliases: []string{"c"}, Required: true},
+		&cli.StringFlag{Name: "config", Usage: "指定Harbor api v2.0的配置文件地址, 同环境变量 `DOO_HARBOR_CONFIG`", Aliases: []string{"c"}},
+		&cli.StringFlag{Name: "registry", Usage: "使用配置文件中指定名称的Harbor实例, 同环境变量 `DOO_HARBOR_REGISTRY`"},
 	},
 	Subcommands: []*cli.Command{
 		{
@@ -109,17 +351,23 @@ var _harbor = &cli.Command{
 			Flags: []cli.Flag{
 				&cli.StringFlag{Name: "project", Usage: "指定项目名称", Aliases: []string{"p"}},
 				&cli.StringFlag{Name: "repository", Usage: "指定仓库名称", Aliases: []string{"r"}},
+				&cli.BoolFlag{Name: "dry-run", Usage: "只打印要删除的镜像及可回收的空间，不执行删除"},
+				&cli.BoolFlag{Name: "yes", Usage: "跳过删除确认", Aliases: []string{"y"}},
 			},
 			Action: harbor.DeleteTagetArtifacts,
 		},
 		{
 			Name:  "clean_artifacts",
-			Usage: "清理N天未被拉取过的，且无标签的镜像文件",
+			Usage: "按保留策略清理镜像，默认清理N天未被拉取过的，且无标签的镜像文件",
 			Flags: []cli.Flag{
-				&cli.StringFlag{Name: "project", Usage: "指定项目名称", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "project", Usage: "指定项目名称，多个用逗号分隔，指定 --rules 时可以不指定，使用规则中的项目", Aliases: []string{"p"}},
 				&cli.StringFlag{Name: "repository", Usage: "指定仓库名称，如果不指定则清理整个项目", Aliases: []string{"r"}},
-				&cli.StringFlag{Name: "days_not_pulled", Usage: "清理N天内没有被拉取过的镜像", Aliases: []string{"d"}},
-				&cli.BoolFlag{Name: "disable_ignore", Usage: "取消对有标签的镜像过滤", Aliases: []string{"i"}},
+				&cli.StringFlag{Name: "rules", Usage: "指定YAML格式的保留策略文件，按项目和仓库配置 keep_last/keep_tags/untagged_days/never_pulled_days/not_pulled_days 以及 in_use，not_pulled_days 对从未拉取的镜像按推送时间计算"},
+				&cli.StringFlag{Name: "days_not_pulled", Usage: "清理N天内没有被拉取过的镜像，从未被拉取过的镜像不论推送时间都会被清理，未指定 --rules 时必填", Aliases: []string{"d"}},
+				&cli.BoolFlag{Name: "disable_ignore", Usage: "取消对有标签的镜像过滤，未指定 --rules 时生效", Aliases: []string{"i"}},
+				&cli.BoolFlag{Name: "dry-run", Usage: "只打印要删除的镜像及可回收的空间，不执行删除"},
+				&cli.BoolFlag{Name: "yes", Usage: "跳过删除确认", Aliases: []string{"y"}},
+				&cli.IntFlag{Name: "concurrency", Usage: "并发删除的数量", Value: 5},
 			},
 			Action: harbor.CleanArtifacts,
 		},
@@ -128,9 +376,246 @@ var _harbor = &cli.Command{
 			Usage: "删除项目",
 			Flags: []cli.Flag{
 				&cli.StringFlag{Name: "project", Usage: "指定项目名称", Aliases: []string{"p"}},
+				&cli.BoolFlag{Name: "dry-run", Usage: "只打印要删除的仓库和镜像及可回收的空间，不执行删除"},
+				&cli.BoolFlag{Name: "yes", Usage: "跳过删除确认", Aliases: []string{"y"}},
+				&cli.IntFlag{Name: "concurrency", Usage: "并发删除的数量", Value: 10},
 			},
 			Action: harbor.DeleteProject,
 		},
+		{
+			Name:  "projects",
+			Usage: "列出项目",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "name", Usage: "按项目名称模糊匹配", Aliases: []string{"n"}},
+				&cli.StringFlag{Name: "visibility", Usage: "只列出 public 或 private 项目"},
+				&cli.StringFlag{Name: "format", Usage: "输出格式 table 或 json", Aliases: []string{"f"}, Value: "table"},
+			},
+			Action: harbor.Projects,
+		},
+		{
+			Name:  "repos",
+			Usage: "列出仓库，包括多级路径的仓库",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "project", Usage: "指定项目名称，多个用逗号分隔，不指定则列出所有项目的仓库", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "name", Usage: "按仓库名称模糊匹配", Aliases: []string{"n"}},
+				&cli.IntFlag{Name: "min-artifacts", Usage: "只列出镜像数量不少于N的仓库"},
+				&cli.StringFlag{Name: "sort", Usage: "排序方式 name、artifacts、pulls 或 updated", Value: "name"},
+				&cli.StringFlag{Name: "format", Usage: "输出格式 table 或 json", Aliases: []string{"f"}, Value: "table"},
+			},
+			Action: harbor.Repos,
+		},
+		{
+			Name:      "copy",
+			Usage:     "复制镜像到另一个项目，指定 --to-registry 时复制到配置文件中的另一个Harbor实例",
+			ArgsUsage: "<src-project/repo:tag> <dst-project/repo>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "to-registry", Usage: "目标Harbor实例在配置文件 registries 中的名称，跨实例复制时目标可以指定新的标签"},
+			},
+			Action: harbor.Copy,
+		},
+		{
+			Name:      "scan",
+			Usage:     "触发镜像的漏洞扫描并等待完成，输出各级别的漏洞数量和漏洞列表",
+			ArgsUsage: "[project/repo:tag ...]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "project", Usage: "不指定镜像时扫描项目下的镜像", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "repository", Usage: "只扫描名称匹配 `PATTERN` 的仓库", Aliases: []string{"r"}},
+				&cli.StringFlag{Name: "tag", Usage: "只扫描标签匹配 `PATTERN` 的镜像", Aliases: []string{"t"}, Value: "*"},
+				&cli.StringFlag{Name: "fail-on", Usage: "存在不低于该级别的漏洞时返回非0，critical、high、medium 或 low"},
+				&cli.StringFlag{Name: "show", Usage: "列出不低于该级别的漏洞", Value: "medium"},
+				&cli.DurationFlag{Name: "timeout", Usage: "等待扫描完成的时间", Value: 10 * time.Minute},
+			},
+			Action: harbor.Scan,
+		},
+		{
+			Name:  "tag",
+			Usage: "管理镜像的标签，删除标签不会删除镜像",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "ls",
+					Usage:     "列出镜像的所有标签",
+					ArgsUsage: "<project/repo:tag|project/repo@digest>",
+					Action:    harbor.TagList,
+				},
+				{
+					Name:      "add",
+					Usage:     "给镜像添加标签",
+					ArgsUsage: "<project/repo:tag|project/repo@digest> <tag>...",
+					Action:    harbor.TagAdd,
+				},
+				{
+					Name:      "rm",
+					Usage:     "删除标签",
+					ArgsUsage: "<project/repo:tag>...",
+					Action:    harbor.TagRemove,
+				},
+			},
+		},
+		{
+			Name:      "retag",
+			Usage:     "将标签移动到同一仓库的另一个镜像上，如把 latest 指向新的 digest",
+			ArgsUsage: "<project/repo:tag> <digest|tag>",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "yes", Usage: "跳过确认", Aliases: []string{"y"}},
+			},
+			Action: harbor.Retag,
+		},
+		{
+			Name:  "immutable",
+			Usage: "管理项目的标签不可变规则",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "project", Usage: "指定项目名称", Aliases: []string{"p"}},
+			},
+			Subcommands: []*cli.Command{
+				{
+					Name:   "ls",
+					Usage:  "列出标签不可变规则",
+					Action: harbor.ImmutableList,
+				},
+				{
+					Name:  "add",
+					Usage: "添加标签不可变规则",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "repos", Usage: "匹配仓库的 `PATTERN`，支持 ** 和 {a,b}", Value: "**"},
+						&cli.StringFlag{Name: "tags", Usage: "匹配标签的 `PATTERN`，如 v* 或 {latest,stable}", Required: true},
+						&cli.BoolFlag{Name: "exclude-repos", Usage: "规则作用于不匹配 --repos 的仓库"},
+						&cli.BoolFlag{Name: "exclude-tags", Usage: "规则作用于不匹配 --tags 的标签"},
+					},
+					Action: harbor.ImmutableAdd,
+				},
+				{
+					Name:      "rm",
+					Usage:     "删除标签不可变规则",
+					ArgsUsage: "<rule id>...",
+					Action:    harbor.ImmutableRemove,
+				},
+			},
+		},
+		{
+			Name:  "robot",
+			Usage: "管理项目级和系统级的机器人账号",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "create",
+					Usage:     "创建机器人账号，密钥只输出一次，可以同时写入gitlab项目的CI/CD变量",
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "project", Usage: "可以访问的项目，--system 时可以指定多个，用逗号分隔，不指定则可以访问所有项目", Aliases: []string{"p"}},
+						&cli.BoolFlag{Name: "system", Usage: "创建系统级账号"},
+						&cli.StringFlag{Name: "access", Usage: "权限，格式为 resource:action，多个用逗号分隔", Value: "repository:pull,repository:push"},
+						&cli.IntFlag{Name: "days", Usage: "有效天数，-1 为永不过期", Value: 90},
+						&cli.StringFlag{Name: "description", Usage: "描述", Aliases: []string{"d"}},
+						&cli.StringFlag{Name: "gitlab-project", Usage: "将账号写入该gitlab项目的CI/CD变量，gitlab地址和token使用环境变量 `DOO_GITLAB_HOST` 和 `DOO_GITLAB_ACCESS_TOKEN`"},
+						&cli.StringFlag{Name: "gitlab-prefix", Usage: "CI/CD变量名前缀，写入 <prefix>REGISTRY、<prefix>USERNAME 和 <prefix>PASSWORD", Value: "HARBOR_"},
+						&cli.BoolFlag{Name: "protected", Usage: "CI/CD变量只在受保护的分支和标签上可用"},
+					},
+					Action: harbor.RobotCreate,
+				},
+				{
+					Name:  "ls",
+					Usage: "列出机器人账号",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "project", Usage: "只列出可以访问该项目的账号", Aliases: []string{"p"}},
+					},
+					Action: harbor.RobotList,
+				},
+				{
+					Name:      "rm",
+					Usage:     "删除机器人账号",
+					ArgsUsage: "<id|name>...",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{Name: "yes", Usage: "跳过删除确认", Aliases: []string{"y"}},
+					},
+					Action: harbor.RobotRemove,
+				},
+				{
+					Name:      "refresh",
+					Usage:     "重新生成机器人账号的密钥，可以同时更新有效期和gitlab项目的CI/CD变量",
+					ArgsUsage: "<id|name>",
+					Flags: []cli.Flag{
+						&cli.IntFlag{Name: "days", Usage: "从现在起的有效天数，-1 为永不过期"},
+						&cli.StringFlag{Name: "gitlab-project", Usage: "将账号写入该gitlab项目的CI/CD变量，gitlab地址和token使用环境变量 `DOO_GITLAB_HOST` 和 `DOO_GITLAB_ACCESS_TOKEN`"},
+						&cli.StringFlag{Name: "gitlab-prefix", Usage: "CI/CD变量名前缀，写入 <prefix>REGISTRY、<prefix>USERNAME 和 <prefix>PASSWORD", Value: "HARBOR_"},
+						&cli.BoolFlag{Name: "protected", Usage: "CI/CD变量只在受保护的分支和标签上可用"},
+					},
+					Action: harbor.RobotRefresh,
+				},
+			},
+		},
+		{
+			Name:  "project",
+			Usage: "按配置文件管理项目",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "create",
+					Usage:     "按YAML配置创建项目，已存在的项目会调整为配置中的可见性、配额、成员、自动扫描、CVE白名单、保留策略和不可变规则，可以重复执行",
+					ArgsUsage: "[project]...",
+					Flags: []cli.Flag{
+						&cli.StringFlag{Name: "file", Usage: "项目配置文件，顶层为 projects 列表", Aliases: []string{"f"}},
+						&cli.BoolFlag{Name: "dry-run", Usage: "只输出需要执行的修改"},
+						&cli.BoolFlag{Name: "prune", Usage: "删除配置中没有的成员和不可变规则"},
+						&cli.BoolFlag{Name: "yes", Usage: "跳过删除确认", Aliases: []string{"y"}},
+					},
+					Action: harbor.ProjectCreate,
+				},
+			},
+		},
+		{
+			Name:  "activity",
+			Usage: "按仓库、用户和日期统计审计日志中的拉取、推送和删除次数，以及N天内没有被拉取过的镜像",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "project", Usage: "指定项目名称，多个用逗号分隔，不指定则统计所有项目", Aliases: []string{"p"}},
+				&cli.StringFlag{Name: "since", Usage: "开始日期，如 2022-01-01，默认为结束日期前30天"},
+				&cli.StringFlag{Name: "until", Usage: "结束日期，包含当天，默认为当前时间"},
+				&cli.IntFlag{Name: "not-pulled", Usage: "列出N天内没有被拉取过的镜像，0 为不列出"},
+				&cli.IntFlag{Name: "top", Usage: "显示操作次数最多的N个仓库和用户", Value: 20},
+				&cli.StringFlag{Name: "format", Usage: "输出格式 table 或 json", Aliases: []string{"f"}, Value: "table"},
+			},
+			Action: harbor.Activity,
+		},
+		{
+			Name:  "usage",
+			Usage: "统计各项目的配额使用、仓库和镜像数量，以及占用最大的仓库、无标签和从未拉取的镜像大小",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "project", Usage: "指定项目名称，多个用逗号分隔，不指定则统计所有项目", Aliases: []string{"p"}},
+				&cli.IntFlag{Name: "top", Usage: "每个项目显示占用最大的N个仓库", Value: 10},
+				&cli.StringFlag{Name: "format", Usage: "输出格式 table 或 json", Aliases: []string{"f"}, Value: "table"},
+			},
+			Action: harbor.Usage,
+		},
+		{
+			Name:  "gc",
+			Usage: "触发垃圾回收并查看回收状态，清理镜像后需要执行垃圾回收才会释放磁盘空间",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "run",
+					Usage: "立即执行一次垃圾回收",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{Name: "dry-run", Usage: "只预估可以释放的空间，不删除数据"},
+						&cli.BoolFlag{Name: "delete-untagged", Usage: "同时删除没有标签的镜像"},
+						&cli.BoolFlag{Name: "wait", Usage: "等待回收完成并输出释放的空间和日志", Aliases: []string{"w"}},
+					},
+					Action: harbor.GCRun,
+				},
+				{
+					Name:      "status",
+					Usage:     "查看定时配置，以及指定任务或最近一次任务的状态、释放的空间和日志",
+					ArgsUsage: "[job id]",
+					Flags: []cli.Flag{
+						&cli.BoolFlag{Name: "no-log", Usage: "不输出任务日志"},
+					},
+					Action: harbor.GCStatus,
+				},
+				{
+					Name:  "history",
+					Usage: "列出最近的垃圾回收任务及释放的空间",
+					Flags: []cli.Flag{
+						&cli.IntFlag{Name: "limit", Usage: "显示最近N次任务", Aliases: []string{"n"}, Value: 10},
+					},
+					Action: harbor.GCHistory,
+				},
+			},
+		},
 	},
 }
 